@@ -15,6 +15,11 @@ type Algorithm interface {
 	// Len returns the total number of items in the LRU.
 	Len() int64
 
+	// Peek returns the size of the item identified by the provided key, or
+	// -1 if the key does not exist in the LRU, without updating the item's
+	// recency.
+	Peek([]byte) int64
+
 	// PutAndEvict inserts the provided key and size into the LRU and
 	// returns a slice of keys that have been evicted as well as the total
 	// size in bytes that were evicted.
@@ -24,6 +29,29 @@ type Algorithm interface {
 	// if the key was successfully added.
 	PutOnStartup([]byte, int64) bool
 
+	// Remove removes the item identified by the provided key from the LRU
+	// and returns the size of the removed item, or -1 if the key does not
+	// exist in the LRU.
+	Remove([]byte) int64
+
 	// Size returns the total size in bytes of all items in the LRU.
 	Size() int64
 }
+
+// StatefulAlgorithm is an Algorithm whose internal state can be serialized. If
+// an LRU's algorithm implements StatefulAlgorithm, its state is checkpointed
+// into the bolt database periodically and when the LRU is closed, and restored
+// exactly when the LRU is opened again, instead of refilling the algorithm
+// with PutOnStartup.
+type StatefulAlgorithm interface {
+	Algorithm
+
+	// MarshalState returns the serialized state of the LRU, including the
+	// recency order of all of its items.
+	MarshalState() ([]byte, error)
+
+	// UnmarshalState replaces the state of the LRU with the provided state
+	// returned by MarshalState. The LRU's current capacity must be
+	// respected, dropping the least recently used items if necessary.
+	UnmarshalState([]byte) error
+}
@@ -59,6 +59,15 @@ func (bl *BasicLRU) Get(key []byte) int64 {
 	return -1
 }
 
+// Peek returns the size of the value corresponding to the provided key, or -1
+// if the key doesn't exist in the LRU, without moving the item to the front.
+func (bl *BasicLRU) Peek(key []byte) int64 {
+	if i, ok := bl.items[string(key)]; ok {
+		return i.size
+	}
+	return -1
+}
+
 // PutAndEvict inserts the provided key and value size into the LRU and returns
 // a slice of keys that have been evicted and total bytes evicted.
 func (bl *BasicLRU) PutAndEvict(key []byte, size int64) ([][]byte, int64) {
@@ -75,6 +84,19 @@ func (bl *BasicLRU) PutAndEvict(key []byte, size int64) ([][]byte, int64) {
 	return bl.prune()
 }
 
+// Remove removes the item with the provided key from the LRU and returns its
+// size, or -1 if the key doesn't exist in the LRU.
+func (bl *BasicLRU) Remove(key []byte) int64 {
+	i, ok := bl.items[string(key)]
+	if !ok {
+		return -1
+	}
+	bl.list.Remove(i.elem)
+	delete(bl.items, string(key))
+	bl.size -= i.size
+	return i.size
+}
+
 // Cap returns the total capacity of the LRU in bytes.
 func (bl *BasicLRU) Cap() int64 {
 	return bl.cap
@@ -140,3 +162,41 @@ func (bl *BasicLRU) evict() ([][]byte, int64) {
 	}
 	return evicted, bevicted
 }
+
+// MarshalState returns the serialized state of the LRU, including the recency
+// order of all of its items.
+func (bl *BasicLRU) MarshalState() ([]byte, error) {
+	return encodeState(walkRecency(bl)), nil
+}
+
+// UnmarshalState replaces the state of the LRU with the provided state returned
+// by MarshalState. Items are restored in their recency order until the LRU's
+// capacity is reached, after which the remaining items are dropped. Evicted
+// items in a TwoQ state are ignored. The LRU is left unchanged if the state is
+// invalid.
+func (bl *BasicLRU) UnmarshalState(state []byte) error {
+	return restoreRecency(bl, state)
+}
+
+// walk calls the provided function for every item, from the most to the least
+// recently used.
+func (bl *BasicLRU) walk(fn func([]byte, int64, uint8)) {
+	for e := bl.list.Front(); e != nil; e = e.Next() {
+		i := e.Value.(*lruItem)
+		fn(i.key, i.size, twoQWarm)
+	}
+}
+
+// restore adds the provided key and value size to the back of the LRU if it
+// has enough capacity and returns true if the key was added. Evicted items of
+// the cold queue are ignored, while the other queues are treated alike.
+func (bl *BasicLRU) restore(key []byte, size int64, queue uint8) bool {
+	if queue == twoQCold || bl.size+size > bl.cap {
+		return false
+	}
+	i := &lruItem{key: key, size: size}
+	bl.size += size
+	i.elem = bl.list.PushBack(i)
+	bl.items[string(key)] = i
+	return true
+}
@@ -61,6 +61,22 @@ var _ = Describe("Basiclru", func() {
 		})
 	})
 
+	Context("Peek", func() {
+
+		It("should return -1 when the key doesn't exist in the LRU", func() {
+			l := DefaultBasicLRU(0)
+			Ω(l.Peek([]byte("key"))).Should(Equal(int64(-1)))
+		})
+
+		It("should return an item's size without moving it to the front", func() {
+			l := DefaultBasicLRU(0)
+			l.PutAndEvict([]byte("1"), 100)
+			l.PutAndEvict([]byte("2"), 200)
+			Ω(l.Peek([]byte("1"))).Should(Equal(int64(100)))
+			Ω(l.list.Front().Value.(*lruItem).key).Should(Equal([]byte("2")))
+		})
+	})
+
 	Context("PutAndEvict", func() {
 
 		It("should insert a new item successfully", func() {
@@ -109,6 +125,27 @@ var _ = Describe("Basiclru", func() {
 		})
 	})
 
+	Context("Remove", func() {
+
+		It("should return -1 when the key doesn't exist in the LRU", func() {
+			l := DefaultBasicLRU(0)
+			size := l.Remove([]byte("key"))
+			Ω(size).Should(Equal(int64(-1)))
+		})
+
+		It("should remove an item from the LRU", func() {
+			l := DefaultBasicLRU(0)
+			l.PutAndEvict([]byte("1"), 100)
+			l.PutAndEvict([]byte("2"), 200)
+			size := l.Remove([]byte("1"))
+			Ω(size).Should(Equal(int64(100)))
+			Ω(l.Size()).Should(Equal(int64(200)))
+			Ω(l.Len()).Should(Equal(int64(1)))
+			Ω(l.items).ShouldNot(HaveKey("1"))
+			Ω(l.Get([]byte("1"))).Should(Equal(int64(-1)))
+		})
+	})
+
 	Context("Empty", func() {
 
 		It("should completely empty the LRU", func() {
@@ -139,6 +176,79 @@ var _ = Describe("Basiclru", func() {
 		})
 	})
 
+	Context("restore", func() {
+
+		It("should append items to the back of the LRU until past its capacity", func() {
+			l := DefaultBasicLRU(0)
+			for i := 0; i < 10; i++ {
+				ok := l.restore([]byte(strconv.Itoa(i)), 100, twoQHot)
+				Ω(ok).Should(BeTrue())
+			}
+			ok := l.restore([]byte("10"), 100, twoQWarm)
+			Ω(ok).Should(BeFalse())
+			var keys []string
+			l.walk(func(key []byte, size int64, queue uint8) {
+				keys = append(keys, string(key))
+				Ω(size).Should(Equal(int64(100)))
+				Ω(queue).Should(Equal(uint8(twoQWarm)))
+			})
+			Ω(keys).Should(HaveLen(10))
+			Ω(keys[0]).Should(Equal("0"))
+			Ω(keys[9]).Should(Equal("9"))
+		})
+	})
+
+	Context("MarshalState", func() {
+
+		It("should restore items in their recency order", func() {
+			l := DefaultBasicLRU(0)
+			for i := 0; i < 3; i++ {
+				l.PutAndEvict([]byte(strconv.Itoa(i)), 100)
+			}
+			l.Get([]byte("0"))
+			state, err := l.MarshalState()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			r := DefaultBasicLRU(0)
+			r.PutAndEvict([]byte("other"), 100)
+			err = r.UnmarshalState(state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.Len()).Should(Equal(int64(3)))
+			Ω(r.Size()).Should(Equal(int64(300)))
+			Ω(r.Peek([]byte("other"))).Should(Equal(int64(-1)))
+			var keys []string
+			for e := r.list.Front(); e != nil; e = e.Next() {
+				keys = append(keys, string(e.Value.(*lruItem).key))
+			}
+			Ω(keys).Should(Equal([]string{"0", "2", "1"}))
+		})
+
+		It("should drop the least recently used items past its capacity", func() {
+			l := DefaultBasicLRU(2000)
+			for i := 0; i < 15; i++ {
+				l.PutAndEvict([]byte(strconv.Itoa(i)), 100)
+			}
+			state, err := l.MarshalState()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			r := DefaultBasicLRU(0)
+			err = r.UnmarshalState(state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.Len()).Should(Equal(int64(10)))
+			Ω(r.Peek([]byte("14"))).Should(Equal(int64(100)))
+			Ω(r.Peek([]byte("5"))).Should(Equal(int64(100)))
+			Ω(r.Peek([]byte("4"))).Should(Equal(int64(-1)))
+		})
+
+		It("should return an error and leave the LRU unchanged for an invalid state", func() {
+			l := DefaultBasicLRU(0)
+			l.PutAndEvict([]byte("key"), 100)
+			err := l.UnmarshalState([]byte{stateVersion, twoQWarm, 10, 'k'})
+			Ω(err).Should(Equal(ErrInvalidState))
+			Ω(l.Peek([]byte("key"))).Should(Equal(int64(100)))
+		})
+	})
+
 	Context("evict", func() {
 
 		It("should return nil when the list is empty", func() {
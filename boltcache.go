@@ -2,6 +2,7 @@ package lru
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -17,29 +18,145 @@ func (l *LRU) openBoltDB() error {
 }
 
 // fillCacheFromBolt fills the cache with all of the values currently in the
-// bolt database. If the cache reaches its capacity, subsequent values are
-// deleted.
+// bolt database. If the LRU's algorithm is a StatefulAlgorithm, its state is
+// first restored from the checkpoint saved when the LRU was last closed or
+// checkpointed, and values missing from the checkpoint are added afterwards.
+// The package's algorithms restore the recency order checkpointed by earlier
+// versions of the package in the same way. If the cache reaches its capacity,
+// subsequent values are deleted. Values past their expiration and stale grace
+// period are deleted as well.
+//
+// Items in a checkpoint whose values are no longer in the database, which may
+// occur if the LRU wasn't closed properly, are removed from the algorithm if
+// the checkpoint uses the encoding of the package's algorithms. Otherwise, they
+// are treated as misses when requested and are eventually evicted.
 func (l *LRU) fillCacheFromBolt() error {
 	// fill the LRU with existing data
 	return l.db.Update(func(tx *bolt.Tx) error {
-		// create the bucket if it doesn't exist
+		// create the buckets if they don't exist
 		b, err := tx.CreateBucketIfNotExists(l.bName)
 		if err != nil {
 			return err
 		}
-		// cycle through all entries and add them to the LRU
-		c := b.Cursor()
+		eb, err := tx.CreateBucketIfNotExists(l.eName)
+		if err != nil {
+			return err
+		}
+		sb, err := tx.CreateBucketIfNotExists(l.sName)
+		if err != nil {
+			return err
+		}
+		jb, err := tx.CreateBucketIfNotExists(l.jName)
+		if err != nil {
+			return err
+		}
+		vb, err := tx.CreateBucketIfNotExists(l.vName)
+		if err != nil {
+			return err
+		}
+		if err := deleteOrphanValues(jb, vb); err != nil {
+			return err
+		}
+		l.loadPending(jb)
+		// discard any streams staged before the LRU was last closed
+		if err := tx.DeleteBucket(l.pName); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(l.pName); err != nil {
+			return err
+		}
 		l.mu.Lock()
 		defer l.mu.Unlock()
+
+		// restore the algorithm's checkpointed state, or the recency
+		// order checkpointed by earlier versions
+		var restored bool
+		state := sb.Get(stateKey)
+		if rb := tx.Bucket(l.rName); rb != nil {
+			if _, ok := l.lru.(recencyAlgorithm); ok && state == nil {
+				state = recencyState(rb, b)
+			}
+			if err := tx.DeleteBucket(l.rName); err != nil {
+				return err
+			}
+		}
+		if sa, ok := l.lru.(StatefulAlgorithm); ok && state != nil {
+			if sa.UnmarshalState(state) == nil {
+				restored = true
+			} else {
+				l.lru.Empty()
+			}
+		}
+
+		// cycle through all entries and add them to the LRU
+		var kept int64
+		var drop [][]byte
+		now := time.Now().Add(-l.grace)
+		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			key := make([]byte, len(k))
 			copy(key, k)
-			if !l.lru.PutOnStartup(key, int64(len(v))) {
-				// avoid rolling back the entire transaction
-				// for a single delete failure
-				_ = c.Delete()
+			var exp time.Time
+			if e := eb.Get(k); e != nil {
+				exp = decodeExpiry(e)
+			}
+			size := int64(len(v))
+			if v == nil {
+				// the value is chunked
+				size = chunkedSize(b.Bucket(k))
+			}
+			if size < 0 || !exp.IsZero() && !now.Before(exp) {
+				if restored {
+					l.lru.Remove(key)
+				}
+				drop = append(drop, key)
+				continue
+			}
+			if restored {
+				if l.lru.Peek(key) == size {
+					l.setExpiry(key, exp)
+					kept++
+					continue
+				}
+				// the checkpointed item is outdated or
+				// missing
+				l.lru.Remove(key)
+			}
+			if !l.lru.PutOnStartup(key, size) {
+				drop = append(drop, key)
+				continue
+			}
+			l.setExpiry(key, exp)
+			kept++
+		}
+		for _, key := range drop {
+			// avoid rolling back the entire transaction for a
+			// single delete failure
+			_ = deleteValue(b, key)
+		}
+
+		// remove checkpointed items whose values are missing
+		if restored && l.lru.Len() != kept {
+			if items, err := decodeState(state); err == nil {
+				for _, i := range items {
+					if i.status != twoQCold && valueSize(b, i.key) < 0 {
+						l.lru.Remove(i.key)
+					}
+				}
+			}
+		}
+
+		// delete the expiration times of values no longer in the cache
+		var orphans [][]byte
+		ec := eb.Cursor()
+		for k, _ := ec.First(); k != nil; k, _ = ec.Next() {
+			if _, ok := l.expires[string(k)]; !ok {
+				orphans = append(orphans, k)
 			}
 		}
+		for _, k := range orphans {
+			_ = eb.Delete(k)
+		}
 		return nil
 	})
 }
@@ -49,13 +166,11 @@ func (l *LRU) fillCacheFromBolt() error {
 func (l *LRU) getFromBolt(key []byte) []byte {
 	var buf []byte
 	err := l.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(l.bName)
-		v := b.Get(key)
-		if v == nil {
+		chunks := getChunks(tx.Bucket(l.bName), key)
+		if chunks == nil {
 			return nil
 		}
-		buf = make([]byte, len(v))
-		copy(buf, v)
+		buf = joinChunks(chunks)
 		return nil
 	})
 	if err != nil {
@@ -64,18 +179,67 @@ func (l *LRU) getFromBolt(key []byte) []byte {
 	return buf
 }
 
+// getMultiFromBolt returns the values corresponding to the provided keys from
+// the bolt database within a single transaction. The value of a key that
+// doesn't exist is nil.
+func (l *LRU) getMultiFromBolt(keys [][]byte) [][]byte {
+	vals := make([][]byte, len(keys))
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(l.bName)
+		for i, key := range keys {
+			if chunks := getChunks(b, key); chunks != nil {
+				vals[i] = joinChunks(chunks)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return make([][]byte, len(keys))
+	}
+	return vals
+}
+
+// getRangeFromBolt returns a copy of the provided range of the value
+// corresponding to the provided key from the bolt database, or nil if the key
+// doesn't exist. ErrInvalidRange is returned if the offset is past the end of
+// the value, along with any error reading the value.
+func (l *LRU) getRangeFromBolt(key []byte, offset, length int64) ([]byte, error) {
+	var buf []byte
+	err := l.db.View(func(tx *bolt.Tx) error {
+		chunks := getChunks(tx.Bucket(l.bName), key)
+		if chunks == nil {
+			return nil
+		}
+		r := newChunkReader(chunks)
+		if offset > r.Size() {
+			return ErrInvalidRange
+		}
+		if length < 0 || offset+length > r.Size() {
+			length = r.Size() - offset
+		}
+		buf = make([]byte, length)
+		_, err := r.ReadAt(buf, offset)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 // getBufFromBolt returns a buffer corresponding to the provided key from the
 // bolt database, or nil if the key doesn't exist.
 func (l *LRU) getBufFromBolt(key []byte) *bytes.Buffer {
 	var buf *bytes.Buffer
 	err := l.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(l.bName)
-		v := b.Get(key)
-		if v == nil {
+		chunks := getChunks(tx.Bucket(l.bName), key)
+		if chunks == nil {
 			return nil
 		}
 		buf = getBuf()
-		buf.Write(v)
+		for _, chunk := range chunks {
+			buf.Write(chunk)
+		}
 		return nil
 	})
 	if err != nil {
@@ -84,12 +248,51 @@ func (l *LRU) getBufFromBolt(key []byte) *bytes.Buffer {
 	return buf
 }
 
-// putIntoBolt writes the provided key and value into the bolt database and
-// returns any error encountered.
-func (l *LRU) putIntoBolt(key, val []byte) error {
+// getReaderFromBolt returns a Reader over the value corresponding to the
+// provided key from the bolt database, or nil if the key doesn't exist. The
+// Reader holds the read transaction open until it is closed.
+func (l *LRU) getReaderFromBolt(key []byte) *Reader {
+	tx, err := l.db.Begin(false)
+	if err != nil {
+		return nil
+	}
+	chunks := getChunks(tx.Bucket(l.bName), key)
+	if chunks == nil {
+		_ = tx.Rollback()
+		return nil
+	}
+	if len(chunks) == 1 {
+		return newReader(tx, chunks[0])
+	}
+	return &Reader{tx: tx, r: newChunkReader(chunks)}
+}
+
+// putIntoBolt writes the provided key, value and expiration time into the bolt
+// database and returns any error encountered. A zero expiration time indicates
+// that the value never expires. Values larger than the chunk size are written
+// as a sequence of chunks. The provided journal entry, if not nil, is queued in
+// the journal within the same transaction as the value.
+func (l *LRU) putIntoBolt(key, val []byte, exp time.Time, j *journalEntry) error {
+	if l.chunkSize > 0 && len(val) > l.chunkSize {
+		return l.putChunksIntoBolt(key, val, exp, j)
+	}
 	return l.db.Batch(func(tx *bolt.Tx) error {
 		b := tx.Bucket(l.bName)
-		return b.Put(key, val)
+		if b.Bucket(key) != nil {
+			if err := b.DeleteBucket(key); err != nil {
+				return err
+			}
+		}
+		if err := b.Put(key, val); err != nil {
+			return err
+		}
+		if err := putExpiry(tx.Bucket(l.eName), key, exp); err != nil {
+			return err
+		}
+		if j != nil {
+			return l.putJournal(tx, j)
+		}
+		return nil
 	})
 }
 
@@ -97,24 +300,65 @@ func (l *LRU) putIntoBolt(key, val []byte) error {
 // encountered.
 func (l *LRU) emptyBolt() error {
 	return l.db.Update(func(tx *bolt.Tx) error {
-		if err := tx.DeleteBucket(l.bName); err != nil {
-			return err
+		for _, name := range [][]byte{l.bName, l.eName, l.sName} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
 		}
-		_, err := tx.CreateBucket(l.bName)
-		return err
+		return nil
 	})
 }
 
 // deleteFromBolt deletes the provided slice of keys from the bolt database and
-// returns any error encountered.
-func (l *LRU) deleteFromBolt(keys [][]byte) error {
+// returns any error encountered. The provided journal entry, if not nil, is
+// queued in the journal within the same transaction.
+func (l *LRU) deleteFromBolt(keys [][]byte, j *journalEntry) error {
 	return l.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(l.bName)
+		eb := tx.Bucket(l.eName)
 		for _, key := range keys {
 			// ignore a delete error to avoid having the entire
 			// transaction fail.
-			_ = b.Delete(key)
+			_ = deleteValue(b, key)
+			_ = eb.Delete(key)
+		}
+		if j != nil {
+			return l.putJournal(tx, j)
+		}
+		return nil
+	})
+}
+
+// deleteMatchingFromBolt deletes all keys greater than or equal to seek that
+// satisfy the provided match function from the bolt database, stopping at the
+// first key that doesn't match. It returns the deleted keys and any error
+// encountered.
+func (l *LRU) deleteMatchingFromBolt(seek []byte, match func([]byte) bool) ([][]byte, error) {
+	var keys [][]byte
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(l.bName)
+		c := b.Cursor()
+		for k, _ := c.Seek(seek); k != nil && match(k); k, _ = c.Next() {
+			key := make([]byte, len(k))
+			copy(key, k)
+			keys = append(keys, key)
+		}
+		eb := tx.Bucket(l.eName)
+		for _, key := range keys {
+			if err := deleteValue(b, key); err != nil {
+				return err
+			}
+			if err := eb.Delete(key); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
 }
@@ -2,6 +2,7 @@ package lru
 
 import (
 	"strconv"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -44,7 +45,7 @@ var _ = Describe("Boltcache", func() {
 			err := l.Open()
 			Ω(err).ShouldNot(HaveOccurred())
 			for i := 0; i < 7; i++ {
-				err = l.putIntoBolt([]byte(strconv.Itoa(i)), make([]byte, 150))
+				err = l.putIntoBolt([]byte(strconv.Itoa(i)), make([]byte, 150), time.Time{}, nil)
 				Ω(err).ShouldNot(HaveOccurred())
 			}
 			closeBoltDB(l)
@@ -70,7 +71,7 @@ var _ = Describe("Boltcache", func() {
 		It("should return the value from bolt", func() {
 			l := newDefaultLRU()
 			defer closeBoltDB(l)
-			err := l.putIntoBolt([]byte("key"), []byte("value"))
+			err := l.putIntoBolt([]byte("key"), []byte("value"), time.Time{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 			v := l.getFromBolt([]byte("key"))
 			Ω(string(v)).Should(Equal("value"))
@@ -79,7 +80,7 @@ var _ = Describe("Boltcache", func() {
 		It("should return nil when the db.View function returns an error", func() {
 			l := newDefaultLRU()
 			defer closeBoltDB(l)
-			err := l.putIntoBolt([]byte("key"), []byte("value"))
+			err := l.putIntoBolt([]byte("key"), []byte("value"), time.Time{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 			l.db.Close()
 			v := l.getFromBolt([]byte("key"))
@@ -99,7 +100,7 @@ var _ = Describe("Boltcache", func() {
 		It("should return a buffer for the value from bolt", func() {
 			l := newDefaultLRU()
 			defer closeBoltDB(l)
-			err := l.putIntoBolt([]byte("key"), []byte("value"))
+			err := l.putIntoBolt([]byte("key"), []byte("value"), time.Time{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 			b := l.getBufFromBolt([]byte("key"))
 			Ω(b.String()).Should(Equal("value"))
@@ -108,7 +109,7 @@ var _ = Describe("Boltcache", func() {
 		It("should return nil when the db.View function returns an error", func() {
 			l := newDefaultLRU()
 			defer closeBoltDB(l)
-			err := l.putIntoBolt([]byte("key"), []byte("value"))
+			err := l.putIntoBolt([]byte("key"), []byte("value"), time.Time{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 			l.db.Close()
 			b := l.getBufFromBolt([]byte("key"))
@@ -122,7 +123,7 @@ var _ = Describe("Boltcache", func() {
 			// create LRU and insert key
 			l := newDefaultLRU()
 			defer closeBoltDB(l)
-			err := l.putIntoBolt([]byte("key"), []byte("value"))
+			err := l.putIntoBolt([]byte("key"), []byte("value"), time.Time{}, nil)
 			Ω(err).ShouldNot(HaveOccurred())
 			v := l.getFromBolt([]byte("key"))
 			Ω(string(v)).Should(Equal("value"))
@@ -153,12 +154,12 @@ var _ = Describe("Boltcache", func() {
 			for i := 0; i < 4; i++ {
 				key := []byte(strconv.Itoa(i))
 				toRemove = append(toRemove, key)
-				err := l.putIntoBolt(key, []byte("value"))
+				err := l.putIntoBolt(key, []byte("value"), time.Time{}, nil)
 				Ω(err).ShouldNot(HaveOccurred())
 			}
 
 			// delete 3 from bolt
-			err := l.deleteFromBolt(toRemove[:3])
+			err := l.deleteFromBolt(toRemove[:3], nil)
 			Ω(err).ShouldNot(HaveOccurred())
 			for i := 0; i < 3; i++ {
 				v := l.getFromBolt(toRemove[i])
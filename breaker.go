@@ -0,0 +1,407 @@
+package lru
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerRate is the default failure rate at which a
+	// CircuitBreakerStore's breaker trips.
+	defaultBreakerRate = 0.5
+
+	// defaultBreakerWindow is the default number of recent retrievals over
+	// which a CircuitBreakerStore's failure rate is computed.
+	defaultBreakerWindow = 20
+
+	// defaultBreakerTimeout is the default duration for which a
+	// CircuitBreakerStore's breaker stays open before probing the store.
+	defaultBreakerTimeout = 5 * time.Second
+)
+
+// BreakerState represents the state of a CircuitBreakerStore's breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all retrievals through to the wrapped store.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails all retrievals without calling the wrapped store.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a limited number of probe retrievals through to
+	// the wrapped store to decide whether to close or reopen the breaker.
+	BreakerHalfOpen
+)
+
+// String returns the name of the breaker state.
+func (bs BreakerState) String() string {
+	switch bs {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOpenError is the error returned by a CircuitBreakerStore when it fails
+// a retrieval because its breaker is open.
+type BreakerOpenError struct {
+	RetryAt time.Time // the time at which the store will next be probed
+}
+
+// Error returns the error's message.
+func (e *BreakerOpenError) Error() string {
+	return "circuit breaker is open"
+}
+
+// IsBreakerOpen returns true if the provided error is a *BreakerOpenError.
+func IsBreakerOpen(err error) bool {
+	_, ok := err.(*BreakerOpenError)
+	return ok
+}
+
+// CircuitBreakerStore is a Store that wraps another Store and stops calling it
+// while it is failing. Its breaker trips open once the rate of failed
+// retrievals over a window of recent retrievals reaches a threshold, and then
+// fails all retrievals fast with a *BreakerOpenError. After a timeout, the
+// breaker turns half-open and lets probe retrievals through: a successful
+// probe closes the breaker, while a failed one reopens it. Not found errors
+// and cancelled retrievals aren't failures.
+//
+// A CircuitBreakerStore provides the optional interfaces of the wrapped store,
+// such as WritableStore or StreamStore. Their calls go through the same
+// breaker as retrievals, since they reach the same failing store, and are
+// failed fast while it is open.
+type CircuitBreakerStore struct {
+	store    Store
+	rate     float64
+	window   int
+	timeout  time.Duration
+	probes   int
+	onChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	outcomes []bool    // ring of recent outcomes, true for failures
+	next     int       // index of the next outcome in the ring
+	n        int       // # of outcomes in the ring
+	failures int       // # of failures in the ring
+	openedAt time.Time // time at which the breaker last opened
+	inflight int       // # of probes in progress while half-open
+	trips    int64     // # of times the breaker opened
+	rejects  int64     // # of retrievals failed while open
+}
+
+// NewCircuitBreakerStore returns a new CircuitBreakerStore wrapping the
+// provided store. By default, the breaker trips once half of the last 20
+// retrievals have failed, and probes the store with a single retrieval after
+// 5s.
+func NewCircuitBreakerStore(store Store) *CircuitBreakerStore {
+	return &CircuitBreakerStore{
+		store:    store,
+		rate:     defaultBreakerRate,
+		window:   defaultBreakerWindow,
+		timeout:  defaultBreakerTimeout,
+		probes:   1,
+		outcomes: make([]bool, defaultBreakerWindow),
+	}
+}
+
+// SetThreshold sets the failure rate, between 0 and 1, at which the breaker
+// trips, computed over the provided number of most recent retrievals. The
+// breaker doesn't trip until that many retrievals have completed since it was
+// last closed. This method must be called before the store is used.
+func (s *CircuitBreakerStore) SetThreshold(rate float64, window int) {
+	if window < 1 {
+		window = 1
+	}
+	s.rate, s.window = rate, window
+	s.outcomes = make([]bool, window)
+}
+
+// SetOpenTimeout sets the duration for which the breaker stays open before
+// turning half-open.
+func (s *CircuitBreakerStore) SetOpenTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+// SetHalfOpenProbes sets the maximum number of concurrent probe retrievals let
+// through while the breaker is half-open. A value lower than 1 is treated as 1.
+func (s *CircuitBreakerStore) SetHalfOpenProbes(probes int) {
+	if probes < 1 {
+		probes = 1
+	}
+	s.probes = probes
+}
+
+// SetOnStateChange sets a function called with the previous and new state each
+// time the breaker changes state. The function is called synchronously by the
+// retrieval causing the change, and must not block.
+func (s *CircuitBreakerStore) SetOnStateChange(fn func(from, to BreakerState)) {
+	s.onChange = fn
+}
+
+// State returns the current state of the breaker.
+func (s *CircuitBreakerStore) State() BreakerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == BreakerOpen && time.Since(s.openedAt) >= s.timeout {
+		return BreakerHalfOpen
+	}
+	return s.state
+}
+
+// Open opens the wrapped store.
+func (s *CircuitBreakerStore) Open() error {
+	return s.store.Open()
+}
+
+// Close closes the wrapped store.
+func (s *CircuitBreakerStore) Close() error {
+	return s.store.Close()
+}
+
+// Get retrieves the value with the provided key from the wrapped store, unless
+// the breaker is open.
+func (s *CircuitBreakerStore) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but passes the provided context to the wrapped store
+// if it is a ContextStore.
+func (s *CircuitBreakerStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	var val []byte
+	err := s.call(ctx, func(ctx context.Context) error {
+		var err error
+		val, err = storeGet(ctx, s.store, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetMulti retrieves the values with the provided keys from the wrapped store,
+// unless the breaker is open, in which case every key fails. The batch fails
+// if any key fails with an error other than a not found error. If the wrapped
+// store isn't a BatchStore, each value is retrieved with its Get method.
+func (s *CircuitBreakerStore) GetMulti(keys [][]byte) ([][]byte, []error) {
+	var vals [][]byte
+	var errs []error
+	err := s.call(context.Background(), func(context.Context) error {
+		vals, errs = storeGetMulti(s.store, keys)
+		return batchErr(errs)
+	})
+	if errs == nil {
+		vals, errs = make([][]byte, len(keys)), make([]error, len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return vals, errs
+}
+
+// GetRange retrieves the provided range of the value with the provided key from
+// the wrapped store, unless the breaker is open. If the wrapped store isn't a
+// RangeStore, the range is sliced from the complete value.
+func (s *CircuitBreakerStore) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	var val []byte
+	err := s.call(context.Background(), func(context.Context) error {
+		var err error
+		val, err = storeGetRange(s.store, key, offset, length)
+		return err
+	})
+	return val, err
+}
+
+// GetStream opens the stream of the value with the provided key from the
+// wrapped store, unless the breaker is open. Only opening the stream counts as
+// the call's outcome. If the wrapped store isn't a StreamStore, the complete
+// value is retrieved and streamed.
+func (s *CircuitBreakerStore) GetStream(key []byte) (io.ReadCloser, int64, error) {
+	var rc io.ReadCloser
+	var size int64
+	err := s.call(context.Background(), func(context.Context) error {
+		var err error
+		rc, size, err = storeGetStream(s.store, key)
+		return err
+	})
+	return rc, size, err
+}
+
+// Put writes the provided key and value into the wrapped store, unless the
+// breaker is open. ErrNotWritable is returned if the wrapped store isn't a
+// WritableStore.
+func (s *CircuitBreakerStore) Put(key, val []byte) error {
+	if _, ok := writableStore(s.store); !ok {
+		return ErrNotWritable
+	}
+	return s.call(context.Background(), func(context.Context) error {
+		return storePut(s.store, key, val)
+	})
+}
+
+// Delete deletes the provided key from the wrapped store, unless the breaker is
+// open. ErrNotWritable is returned if the wrapped store isn't a WritableStore.
+func (s *CircuitBreakerStore) Delete(key []byte) error {
+	if _, ok := writableStore(s.store); !ok {
+		return ErrNotWritable
+	}
+	return s.call(context.Background(), func(context.Context) error {
+		return storeDelete(s.store, key)
+	})
+}
+
+// wrapped returns the wrapped store.
+func (s *CircuitBreakerStore) wrapped() Store {
+	return s.store
+}
+
+// call calls the provided function with the provided context if the breaker
+// allows it, and records its outcome. Not found errors aren't failures, while
+// ErrNotWritable and errors of a call whose context is done are neutral.
+func (s *CircuitBreakerStore) call(ctx context.Context, fn func(context.Context) error) (err error) {
+	probe, err := s.allow()
+	if err != nil {
+		return err
+	}
+	// record the outcome even if the store panics, counting the panic as a
+	// failure so that a probe is always released
+	defer func() {
+		if r := recover(); r != nil {
+			s.record(probe, true, false)
+			panic(r)
+		}
+		neutral := err != nil && (ctx.Err() != nil || err == ErrNotWritable)
+		s.record(probe, err != nil && !IsNotFound(err) && !neutral, neutral)
+	}()
+	return fn(ctx)
+}
+
+// allow returns whether a retrieval may go through to the wrapped store, as a
+// probe if the breaker is half-open, or a *BreakerOpenError otherwise.
+func (s *CircuitBreakerStore) allow() (bool, error) {
+	s.mu.Lock()
+	from := s.state
+	if s.state == BreakerOpen && time.Since(s.openedAt) >= s.timeout {
+		s.state = BreakerHalfOpen
+		s.inflight = 0
+	}
+	var probe bool
+	var err error
+	switch s.state {
+	case BreakerOpen:
+		err = s.reject()
+	case BreakerHalfOpen:
+		if s.inflight >= s.probes {
+			err = s.reject()
+		} else {
+			s.inflight++
+			probe = true
+		}
+	}
+	to := s.state
+	s.mu.Unlock()
+	s.notify(from, to)
+	return probe, err
+}
+
+// reject counts a rejected retrieval and returns its error.
+// Note: this method should only be called when the mutex is locked!
+func (s *CircuitBreakerStore) reject() error {
+	s.rejects++
+	return &BreakerOpenError{RetryAt: s.openedAt.Add(s.timeout)}
+}
+
+// record records the outcome of a retrieval that went through to the wrapped
+// store, changing the breaker's state as required. A neutral outcome, such as
+// a cancelled retrieval, releases a probe without deciding the breaker's state.
+func (s *CircuitBreakerStore) record(probe, failed, neutral bool) {
+	s.mu.Lock()
+	from := s.state
+	switch {
+	case probe:
+		if s.state != BreakerHalfOpen {
+			break
+		}
+		s.inflight--
+		if failed {
+			s.trip()
+		} else if !neutral {
+			s.state = BreakerClosed
+			s.n, s.next, s.failures = 0, 0, 0
+		}
+	case s.state == BreakerClosed && !neutral:
+		if s.n == s.window {
+			if s.outcomes[s.next] {
+				s.failures--
+			}
+		} else {
+			s.n++
+		}
+		s.outcomes[s.next] = failed
+		s.next = (s.next + 1) % s.window
+		if failed {
+			s.failures++
+		}
+		if s.n == s.window && float64(s.failures) >= s.rate*float64(s.window) {
+			s.trip()
+		}
+	}
+	to := s.state
+	s.mu.Unlock()
+	s.notify(from, to)
+}
+
+// trip opens the breaker.
+// Note: this method should only be called when the mutex is locked!
+func (s *CircuitBreakerStore) trip() {
+	s.state = BreakerOpen
+	s.openedAt = time.Now()
+	s.trips++
+}
+
+// notify calls the state change function if the provided states differ.
+func (s *CircuitBreakerStore) notify(from, to BreakerState) {
+	if from != to && s.onChange != nil {
+		s.onChange(from, to)
+	}
+}
+
+// StoreStats returns the CircuitBreakerStore's current stats, added to those of
+// the wrapped store. BreakerState holds the breaker's state, BreakerTrips the
+// number of times it opened and BreakerRejects the number of retrievals it
+// failed fast.
+func (s *CircuitBreakerStore) StoreStats() StoreStats {
+	return s.stats(false)
+}
+
+// ResetStoreStats resets the CircuitBreakerStore's stats, along with those of
+// the wrapped store, and returns its stats as they were immediately before
+// being reset. The breaker's state is left unchanged.
+func (s *CircuitBreakerStore) ResetStoreStats() StoreStats {
+	return s.stats(true)
+}
+
+// stats returns the CircuitBreakerStore's current stats, and resets them if
+// reset is true.
+func (s *CircuitBreakerStore) stats(reset bool) StoreStats {
+	stats := storeStats(s.store, reset)
+	state := s.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.BreakerState = state.String()
+	stats.BreakerTrips += s.trips
+	stats.BreakerRejects += s.rejects
+	if reset {
+		s.trips, s.rejects = 0, 0
+	}
+	return stats
+}
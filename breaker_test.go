@@ -0,0 +1,244 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreakerStore", func() {
+
+	// toggleStore returns a store failing while fail is non-zero, and the
+	// number of retrievals made.
+	toggleStore := func(fail *int32) (Store, *int32) {
+		var calls int32
+		return newStore(func(key []byte) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			if atomic.LoadInt32(fail) != 0 {
+				return nil, errors.New("test error")
+			}
+			if string(key) == "missing" {
+				return nil, ErrNotFound
+			}
+			return []byte("value"), nil
+		}), &calls
+	}
+
+	Context("Get", func() {
+
+		It("should trip once the failure rate reaches the threshold", func() {
+			fail := int32(0)
+			st, calls := toggleStore(&fail)
+			s := NewCircuitBreakerStore(st)
+			s.SetThreshold(0.5, 4)
+			s.SetOpenTimeout(time.Hour)
+			for _, key := range []string{"a", "missing"} {
+				s.Get([]byte(key))
+			}
+			atomic.StoreInt32(&fail, 1)
+			s.Get([]byte("a"))
+			Ω(s.State()).Should(Equal(BreakerClosed))
+			s.Get([]byte("a"))
+			Ω(s.State()).Should(Equal(BreakerOpen))
+
+			_, err := s.Get([]byte("a"))
+			Ω(IsBreakerOpen(err)).Should(BeTrue())
+			Ω(err.(*BreakerOpenError).RetryAt).Should(BeTemporally(">", time.Now()))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(4)))
+			stats := s.StoreStats()
+			Ω(stats.BreakerState).Should(Equal("open"))
+			Ω(stats.BreakerTrips).Should(Equal(int64(1)))
+			Ω(stats.BreakerRejects).Should(Equal(int64(1)))
+		})
+
+		It("should probe the store once half-open", func() {
+			fail := int32(1)
+			st, calls := toggleStore(&fail)
+			s := NewCircuitBreakerStore(st)
+			s.SetThreshold(1, 1)
+			s.SetOpenTimeout(10 * time.Millisecond)
+			var mu sync.Mutex
+			var changes []string
+			s.SetOnStateChange(func(from, to BreakerState) {
+				mu.Lock()
+				changes = append(changes, from.String()+" -> "+to.String())
+				mu.Unlock()
+			})
+			s.Get([]byte("a"))
+			Ω(s.State()).Should(Equal(BreakerOpen))
+			Eventually(s.State).Should(Equal(BreakerHalfOpen))
+			_, err := s.Get([]byte("a"))
+			Ω(err).Should(MatchError("test error"))
+			Ω(s.State()).Should(Equal(BreakerOpen))
+
+			atomic.StoreInt32(&fail, 0)
+			Eventually(s.State).Should(Equal(BreakerHalfOpen))
+			v, err := s.Get([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			Ω(s.State()).Should(Equal(BreakerClosed))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(3)))
+			mu.Lock()
+			defer mu.Unlock()
+			Ω(changes).Should(Equal([]string{
+				"closed -> open",
+				"open -> half-open",
+				"half-open -> open",
+				"open -> half-open",
+				"half-open -> closed",
+			}))
+		})
+
+		It("should limit the number of concurrent probes", func() {
+			release := make(chan struct{})
+			var calls int32
+			st := newStore(func(key []byte) ([]byte, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return nil, errors.New("test error")
+				}
+				<-release
+				return []byte("value"), nil
+			})
+			s := NewCircuitBreakerStore(st)
+			s.SetThreshold(1, 1)
+			s.SetOpenTimeout(0)
+			s.Get([]byte("a"))
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s.Get([]byte("a"))
+			}()
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&calls)
+			}).Should(Equal(int32(2)))
+			_, err := s.Get([]byte("a"))
+			Ω(IsBreakerOpen(err)).Should(BeTrue())
+			close(release)
+			<-done
+			Ω(s.State()).Should(Equal(BreakerClosed))
+		})
+
+		It("should count a panicking probe as a failure", func() {
+			var panics int32
+			st := newStore(func(key []byte) ([]byte, error) {
+				if atomic.LoadInt32(&panics) != 0 {
+					panic("test panic")
+				}
+				return nil, errors.New("test error")
+			})
+			s := NewCircuitBreakerStore(st)
+			s.SetThreshold(1, 1)
+			s.SetOpenTimeout(0)
+			s.Get([]byte("a"))
+			atomic.StoreInt32(&panics, 1)
+			Ω(func() { s.Get([]byte("a")) }).Should(Panic())
+			Ω(s.State()).Should(Equal(BreakerHalfOpen))
+			Ω(s.inflight).Should(Equal(0))
+			Ω(func() { s.Get([]byte("a")) }).Should(Panic())
+
+			l := NewLRU("", "", DefaultTwoQ(0), s)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			_, err = l.Get([]byte("a"))
+			Ω(err).Should(MatchError("panic: test panic"))
+			Ω(s.StoreStats().BreakerTrips).Should(Equal(int64(4)))
+		})
+
+		It("should not count cancelled retrievals as failures", func() {
+			st := newContextStore(func(ctx context.Context, key []byte) ([]byte, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+			s := NewCircuitBreakerStore(st)
+			s.SetThreshold(1, 1)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := s.GetContext(ctx, []byte("a"))
+			Ω(err).Should(Equal(context.Canceled))
+			Ω(s.State()).Should(Equal(BreakerClosed))
+		})
+	})
+
+	Context("optional interfaces", func() {
+
+		It("should pass the wrapped store's interfaces through the breaker", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			s := NewCircuitBreakerStore(ws)
+			s.SetThreshold(1, 2)
+			s.SetOpenTimeout(time.Hour)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeTrue())
+			_, ok = batchStore(s)
+			Ω(ok).Should(BeFalse())
+			err := s.Put([]byte("key"), []byte("value"))
+			Ω(err).Should(MatchError("test error"))
+			err = s.Delete([]byte("key"))
+			Ω(err).Should(MatchError("test error"))
+			Ω(s.State()).Should(Equal(BreakerOpen))
+			ws.setFail(false)
+			err = s.Put([]byte("key"), []byte("value"))
+			Ω(IsBreakerOpen(err)).Should(BeTrue())
+			vals, errs := s.GetMulti([][]byte{[]byte("a"), []byte("b")})
+			Ω(vals).Should(HaveLen(2))
+			Ω(IsBreakerOpen(errs[0])).Should(BeTrue())
+			Ω(IsBreakerOpen(errs[1])).Should(BeTrue())
+			Ω(ws.ops()).Should(BeEmpty())
+		})
+
+		It("should not count writes into a store that isn't writable", func() {
+			fail := int32(0)
+			st, _ := toggleStore(&fail)
+			s := NewCircuitBreakerStore(st)
+			s.SetThreshold(1, 1)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeFalse())
+			err := s.Put([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			Ω(s.State()).Should(Equal(BreakerClosed))
+
+			// nor into a wrapped store that isn't writable
+			s = NewCircuitBreakerStore(NewRetryStore(st))
+			s.SetThreshold(1, 1)
+			err = s.Put([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			err = s.Delete([]byte("key"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			Ω(s.State()).Should(Equal(BreakerClosed))
+		})
+	})
+
+	Context("Stats", func() {
+
+		It("should include the breaker's stats in the LRU's stats", func() {
+			fail := int32(1)
+			st, _ := toggleStore(&fail)
+			cb := NewCircuitBreakerStore(st)
+			cb.SetThreshold(1, 1)
+			cb.SetOpenTimeout(time.Hour)
+			l := NewLRU("", "", DefaultTwoQ(0), NewRetryStore(cb))
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			// the retry of the failed retrieval is rejected
+			_, err = l.Get([]byte("a"))
+			Ω(IsBreakerOpen(err)).Should(BeTrue())
+			_, err = l.Get([]byte("b"))
+			Ω(IsBreakerOpen(err)).Should(BeTrue())
+			s := l.ResetStats()
+			Ω(s.Store.BreakerState).Should(Equal("open"))
+			Ω(s.Store.BreakerTrips).Should(Equal(int64(1)))
+			Ω(s.Store.BreakerRejects).Should(Equal(int64(2)))
+			Ω(s.Store.Retries).Should(Equal(int64(1)))
+			s = l.Stats()
+			Ω(s.Store.BreakerState).Should(Equal("open"))
+			Ω(s.Store.BreakerTrips).Should(Equal(int64(0)))
+		})
+	})
+})
@@ -0,0 +1,137 @@
+package lru
+
+import (
+	"context"
+	"sync"
+)
+
+// ChainStore is a Store composed of a chain of stores, ordered from the fastest
+// to the slowest (e.g. a shared cache in front of the origin). A value is
+// retrieved from each store in turn until one of them returns it. Errors from
+// all but the last store are treated as misses, so that an unavailable tier is
+// skipped; the last store's error is returned if no store has the value.
+type ChainStore struct {
+	stores   []Store
+	backfill bool
+
+	mu   sync.Mutex
+	hits []int64 // # of values served by each store
+}
+
+// NewChainStore returns a new ChainStore composed of the provided stores, in
+// the order in which they are tried.
+func NewChainStore(stores ...Store) *ChainStore {
+	return &ChainStore{
+		stores: stores,
+		hits:   make([]int64, len(stores)),
+	}
+}
+
+// SetBackfill sets whether a value served by a store is written into the
+// stores preceding it in the chain that are WritableStores. Backfill errors are
+// ignored. Backfill is disabled by default.
+func (s *ChainStore) SetBackfill(backfill bool) {
+	s.backfill = backfill
+}
+
+// Open opens all stores in the chain, in order. If a store fails to open, the
+// stores already opened are closed and the error is returned.
+func (s *ChainStore) Open() error {
+	for i, st := range s.stores {
+		if err := st.Open(); err != nil {
+			for _, opened := range s.stores[:i] {
+				opened.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all stores in the chain and returns the first error
+// encountered.
+func (s *ChainStore) Close() error {
+	var ferr error
+	for _, st := range s.stores {
+		if err := st.Close(); err != nil && ferr == nil {
+			ferr = err
+		}
+	}
+	return ferr
+}
+
+// Get retrieves the value with the provided key from the first store in the
+// chain that has it.
+func (s *ChainStore) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but passes the provided context to each store that
+// is a ContextStore, and stops once the context is done.
+func (s *ChainStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	err := error(ErrNotFound)
+	for i, st := range s.stores {
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, cerr
+		}
+		var val []byte
+		val, err = storeGet(ctx, st, key)
+		if err == nil && val == nil {
+			err = ErrNoValue
+		}
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		s.hits[i]++
+		s.mu.Unlock()
+		if s.backfill {
+			s.backfillStores(i, key, val)
+		}
+		return val, nil
+	}
+	return nil, err
+}
+
+// backfillStores writes the provided key and value into the WritableStores
+// preceding the store with the provided index.
+func (s *ChainStore) backfillStores(idx int, key, val []byte) {
+	for _, st := range s.stores[:idx] {
+		if ws, ok := writableStore(st); ok {
+			_ = ws.Put(key, val)
+		}
+	}
+}
+
+// StoreStats returns the ChainStore's current stats, added to those of the
+// stores in the chain. TierHits holds the number of values served by each store
+// in the chain.
+func (s *ChainStore) StoreStats() StoreStats {
+	stats := s.tierStats(false)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.TierHits = append([]int64(nil), s.hits...)
+	return stats
+}
+
+// ResetStoreStats resets the ChainStore's stats, along with those of the stores
+// in the chain, and returns its stats as they were immediately before being
+// reset.
+func (s *ChainStore) ResetStoreStats() StoreStats {
+	stats := s.tierStats(true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.TierHits = s.hits
+	s.hits = make([]int64, len(s.stores))
+	return stats
+}
+
+// tierStats returns the sum of the stats of the stores in the chain, and resets
+// them if reset is true.
+func (s *ChainStore) tierStats(reset bool) StoreStats {
+	var stats StoreStats
+	for _, st := range s.stores {
+		stats.add(storeStats(st, reset))
+	}
+	return stats
+}
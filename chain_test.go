@@ -0,0 +1,110 @@
+package lru
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChainStore", func() {
+
+	Context("Get", func() {
+
+		It("should return the value from the first store that has it", func() {
+			shared := newWritableStore()
+			shared.Put([]byte("a"), []byte("shared"))
+			origin := newStore(func(key []byte) ([]byte, error) {
+				return []byte("origin"), nil
+			})
+			s := NewChainStore(shared, origin)
+			v, err := s.Get([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("shared")))
+			v, err = s.Get([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("origin")))
+			Ω(shared.value("b")).Should(BeNil())
+			Ω(s.StoreStats().TierHits).Should(Equal([]int64{1, 1}))
+		})
+
+		It("should skip a failing store and return the last store's error", func() {
+			failing := newStore(func(key []byte) ([]byte, error) {
+				return nil, errors.New("test error")
+			})
+			origin := newStore(func(key []byte) ([]byte, error) {
+				if string(key) == "a" {
+					return []byte("origin"), nil
+				}
+				return nil, ErrNotFound
+			})
+			s := NewChainStore(failing, origin)
+			v, err := s.Get([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("origin")))
+			_, err = s.Get([]byte("b"))
+			Ω(err).Should(Equal(ErrNotFound))
+			_, err = NewChainStore().Get([]byte("a"))
+			Ω(err).Should(Equal(ErrNotFound))
+		})
+
+		It("should backfill the preceding writable stores", func() {
+			l1, l2 := newWritableStore(), newWritableStore()
+			l2.Put([]byte("a"), []byte("value"))
+			origin := newStore(func(key []byte) ([]byte, error) {
+				return []byte("origin"), nil
+			})
+			s := NewChainStore(l1, l2, origin)
+			s.SetBackfill(true)
+			v, err := s.Get([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			Ω(l1.value("a")).Should(Equal([]byte("value")))
+			_, err = s.Get([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l1.value("b")).Should(Equal([]byte("origin")))
+			Ω(l2.value("b")).Should(Equal([]byte("origin")))
+		})
+
+		It("should stop once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			first := newContextStore(func(ctx context.Context, key []byte) ([]byte, error) {
+				cancel()
+				return nil, ctx.Err()
+			})
+			var called bool
+			second := newStore(func(key []byte) ([]byte, error) {
+				called = true
+				return []byte("value"), nil
+			})
+			_, err := NewChainStore(first, second).GetContext(ctx, []byte("a"))
+			Ω(err).Should(Equal(context.Canceled))
+			Ω(called).Should(BeFalse())
+		})
+	})
+
+	Context("Stats", func() {
+
+		It("should break down the LRU's misses by tier", func() {
+			shared := newWritableStore()
+			shared.Put([]byte("a"), []byte("shared"))
+			origin := newStore(func(key []byte) ([]byte, error) {
+				return []byte("origin"), nil
+			})
+			l := NewLRU("", "", DefaultTwoQ(0), NewChainStore(shared, origin))
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			for _, key := range []string{"a", "b", "c"} {
+				_, err = l.Get([]byte(key))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			s := l.ResetStats()
+			Ω(s.Misses).Should(Equal(int64(3)))
+			Ω(s.Store.TierHits).Should(Equal([]int64{1, 2}))
+			s = l.Stats()
+			Ω(s.Store.TierHits).Should(Equal([]int64{0, 0}))
+		})
+	})
+})
@@ -0,0 +1,317 @@
+package lru
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// maxTxChunks is the maximum number of chunks of a value written into the bolt
+// database within a single transaction.
+const maxTxChunks = 16
+
+// chunkSizeKey is the key of the total size of a chunked value within its
+// nested bucket. It is written last, once all chunks have been written.
+var chunkSizeKey = []byte("n")
+
+// SetChunkSize sets the size in bytes above which values are stored in the
+// bolt database as a sequence of chunks of the provided size, rather than as a
+// single value. Large values are then written across multiple transactions and
+// reassembled transparently when read. A size that is not positive, which is
+// the default, disables chunking. Values streamed from a StreamStore are
+// cached in the chunks in which they were staged, regardless of this size.
+// This method must be called before Open.
+func (l *LRU) SetChunkSize(size int) {
+	l.chunkSize = size
+}
+
+// chunkKey returns the key of the chunk with the provided index within the
+// nested bucket of a chunked value.
+func chunkKey(idx uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, idx)
+	return k
+}
+
+// getChunks returns the value with the provided key from the provided bucket
+// as a slice of chunks, or nil if the key doesn't exist or its chunks are
+// incomplete. A value that isn't chunked is returned as a single chunk. The
+// chunks are only valid for the life of the transaction.
+func getChunks(b *bolt.Bucket, key []byte) [][]byte {
+	if v := b.Get(key); v != nil {
+		return [][]byte{v}
+	}
+	cb := b.Bucket(key)
+	if cb == nil {
+		return nil
+	}
+	size := chunkedSize(cb)
+	if size < 0 {
+		return nil
+	}
+	var chunks [][]byte
+	var n int64
+	for idx := uint64(0); n < size; idx++ {
+		chunk := cb.Get(chunkKey(idx))
+		if len(chunk) == 0 {
+			return nil
+		}
+		chunks = append(chunks, chunk)
+		n += int64(len(chunk))
+	}
+	if n != size {
+		return nil
+	}
+	if len(chunks) == 0 {
+		return [][]byte{{}}
+	}
+	return chunks
+}
+
+// chunkedSize returns the total size of the chunked value with the provided
+// nested bucket, or -1 if the value is incomplete.
+func chunkedSize(cb *bolt.Bucket) int64 {
+	v := cb.Get(chunkSizeKey)
+	if len(v) != 8 {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+// valueSize returns the size of the value with the provided key from the
+// provided bucket, or -1 if the key doesn't exist or its chunks are incomplete.
+func valueSize(b *bolt.Bucket, key []byte) int64 {
+	if v := b.Get(key); v != nil {
+		return int64(len(v))
+	}
+	if cb := b.Bucket(key); cb != nil {
+		return chunkedSize(cb)
+	}
+	return -1
+}
+
+// joinChunks returns a copy of the provided chunks joined into a single value.
+func joinChunks(chunks [][]byte) []byte {
+	var size int
+	for _, chunk := range chunks {
+		size += len(chunk)
+	}
+	val := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		val = append(val, chunk...)
+	}
+	return val
+}
+
+// deleteValue deletes the value with the provided key from the provided bucket,
+// whether it is chunked or not.
+func deleteValue(b *bolt.Bucket, key []byte) error {
+	if b.Bucket(key) != nil {
+		return b.DeleteBucket(key)
+	}
+	return b.Delete(key)
+}
+
+// putChunksIntoBolt writes the provided key and value into the bolt database as
+// a sequence of chunks of the LRU's chunk size, as writeChunks does.
+func (l *LRU) putChunksIntoBolt(key, val []byte, exp time.Time, j *journalEntry) error {
+	size := int64(len(val))
+	return l.writeChunks(key, size, exp, j, func(tx *bolt.Tx, idx uint64) ([]byte, error) {
+		n := l.chunkSize
+		if n > len(val) {
+			n = len(val)
+		}
+		chunk := val[:n]
+		val = val[n:]
+		return chunk, nil
+	})
+}
+
+// writeChunks writes the value with the provided key and size into the bolt
+// database as the sequence of chunks returned by the provided function, which
+// is called within each transaction with the index of the next chunk. At most
+// maxTxChunks chunks are written per transaction. Once the chunks add up to
+// the value's size, its size, the provided expiration time and the provided
+// journal entry, if not nil, are written along with the last chunks. Until
+// then, the value is considered missing. An empty chunk returned before then
+// fails the write with errChunkMissing. The journal entry's value is written
+// into the journal values bucket in the same chunks as the cached value, rather
+// than as a single value within the entry.
+func (l *LRU) writeChunks(key []byte, size int64, exp time.Time, j *journalEntry, next func(*bolt.Tx, uint64) ([]byte, error)) error {
+	var idx, seq uint64
+	var n int64
+	for first := true; first || n < size; first = false {
+		err := l.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(l.bName)
+			if first {
+				if err := deleteValue(b, key); err != nil {
+					return err
+				}
+				if _, err := b.CreateBucket(key); err != nil {
+					return err
+				}
+				if j != nil {
+					var err error
+					if seq, err = l.reserveJournal(tx); err != nil {
+						return err
+					}
+				}
+			}
+			cbs := []*bolt.Bucket{b.Bucket(key)}
+			if j != nil {
+				cbs = append(cbs, tx.Bucket(l.vName).Bucket(encodeSeq(seq)))
+			}
+			for _, cb := range cbs {
+				if cb == nil {
+					return errChunkMissing
+				}
+			}
+			for i := 0; i < maxTxChunks && n < size; i++ {
+				chunk, err := next(tx, idx)
+				if err != nil {
+					return err
+				}
+				if len(chunk) == 0 {
+					return errChunkMissing
+				}
+				for _, cb := range cbs {
+					if err := cb.Put(chunkKey(idx), chunk); err != nil {
+						return err
+					}
+				}
+				n += int64(len(chunk))
+				idx++
+			}
+			if n < size {
+				return nil
+			}
+			if n > size {
+				return errChunkMissing
+			}
+			sb := make([]byte, 8)
+			binary.BigEndian.PutUint64(sb, uint64(size))
+			for _, cb := range cbs {
+				if err := cb.Put(chunkSizeKey, sb); err != nil {
+					return err
+				}
+			}
+			if err := putExpiry(tx.Bucket(l.eName), key, exp); err != nil {
+				return err
+			}
+			if j != nil {
+				return l.queueJournal(tx, seq, &journalEntry{
+					op:   journalPutChunked,
+					time: j.time,
+					key:  j.key,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			if j != nil && !first {
+				// discard the journal entry's chunks written so far
+				l.db.Update(func(tx *bolt.Tx) error {
+					return l.deleteJournalValue(tx, encodeSeq(seq))
+				})
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkReader reads a value stored as a sequence of chunks. All chunks except
+// the last one must have the same size.
+type chunkReader struct {
+	chunks [][]byte
+	size   int64
+	off    int64
+}
+
+// newChunkReader returns a new chunkReader over the provided chunks.
+func newChunkReader(chunks [][]byte) *chunkReader {
+	var size int64
+	for _, chunk := range chunks {
+		size += int64(len(chunk))
+	}
+	return &chunkReader{chunks: chunks, size: size}
+}
+
+// chunkAt returns the remainder of the chunk containing the provided offset, or
+// nil if the offset is past the end of the value.
+func (cr *chunkReader) chunkAt(off int64) []byte {
+	if off >= cr.size {
+		return nil
+	}
+	cs := int64(len(cr.chunks[0]))
+	return cr.chunks[off/cs][off%cs:]
+}
+
+// Read reads up to len(p) bytes of the value into p.
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	chunk := cr.chunkAt(cr.off)
+	if chunk == nil {
+		return 0, io.EOF
+	}
+	n := copy(p, chunk)
+	cr.off += int64(n)
+	return n, nil
+}
+
+// ReadAt reads len(p) bytes of the value into p starting at the provided
+// offset.
+func (cr *chunkReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	var n int
+	for n < len(p) {
+		chunk := cr.chunkAt(off + int64(n))
+		if chunk == nil {
+			return n, io.EOF
+		}
+		n += copy(p[n:], chunk)
+	}
+	return n, nil
+}
+
+// Seek sets the offset for the next Read according to whence, as defined by
+// io.Seeker.
+func (cr *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cr.off
+	case io.SeekEnd:
+		offset += cr.size
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	cr.off = offset
+	return offset, nil
+}
+
+// WriteTo writes the remainder of the value to the provided io.Writer directly
+// from its chunks.
+func (cr *chunkReader) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for chunk := cr.chunkAt(cr.off); chunk != nil; chunk = cr.chunkAt(cr.off) {
+		m, err := w.Write(chunk)
+		cr.off += int64(m)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Size returns the total size of the value in bytes.
+func (cr *chunkReader) Size() int64 {
+	return cr.size
+}
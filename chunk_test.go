@@ -0,0 +1,189 @@
+package lru
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chunk", func() {
+
+	var val = []byte("0123456789abcdefghij!")
+
+	newChunkedLRU := func() *LRU {
+		l := NewLRU("", "", DefaultTwoQ(0), nil)
+		l.SetChunkSize(4)
+		err := l.Open()
+		Ω(err).ShouldNot(HaveOccurred())
+		return l
+	}
+
+	Context("putIntoBolt", func() {
+
+		It("should store a large value as a sequence of chunks", func() {
+			l := newChunkedLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), val)
+			Ω(err).ShouldNot(HaveOccurred())
+			l.db.View(func(tx *bolt.Tx) error {
+				b := tx.Bucket(l.bName)
+				Ω(b.Get([]byte("key"))).Should(BeNil())
+				cb := b.Bucket([]byte("key"))
+				Ω(cb).ShouldNot(BeNil())
+				Ω(cb.Stats().KeyN).Should(Equal(7))
+				Ω(chunkedSize(cb)).Should(Equal(int64(len(val))))
+				return nil
+			})
+			Ω(l.lru.Len()).Should(Equal(int64(1)))
+			Ω(l.lru.Size()).Should(Equal(int64(len(val))))
+		})
+
+		It("should replace a chunked value with a small value and back", func() {
+			l := newChunkedLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), val)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.put([]byte("key"), []byte("abc"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.getFromBolt([]byte("key"))).Should(Equal([]byte("abc")))
+			err = l.putIntoBolt([]byte("key"), val, time.Now().Add(time.Hour), nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.getFromBolt([]byte("key"))).Should(Equal(val))
+			l.db.View(func(tx *bolt.Tx) error {
+				Ω(tx.Bucket(l.eName).Get([]byte("key"))).ShouldNot(BeNil())
+				return nil
+			})
+		})
+	})
+
+	Context("reading", func() {
+
+		It("should reassemble a chunked value transparently", func() {
+			l := newChunkedLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), val)
+			Ω(err).ShouldNot(HaveOccurred())
+			l.store = &errStore{}
+
+			v, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal(val))
+
+			buf, err := l.GetBuffer([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(buf.Bytes()).Should(Equal(val))
+			buf.Close()
+
+			vals, errs := l.GetMulti([][]byte{[]byte("key")})
+			Ω(errs[0]).ShouldNot(HaveOccurred())
+			Ω(vals[0]).Should(Equal(val))
+
+			v, err = l.GetRange([]byte("key"), 3, 7)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("3456789"))
+			_, err = l.GetRange([]byte("key"), 22, 1)
+			Ω(err).Should(MatchError(ErrInvalidRange))
+
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r.Close()
+			Ω(r.Size()).Should(Equal(int64(len(val))))
+			v, err = ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal(val))
+		})
+
+		It("should treat an incomplete chunked value as missing", func() {
+			l := newChunkedLRU()
+			defer closeBoltDB(l)
+			err := l.db.Update(func(tx *bolt.Tx) error {
+				cb, err := tx.Bucket(l.bName).CreateBucket([]byte("key"))
+				if err != nil {
+					return err
+				}
+				return cb.Put(chunkKey(0), []byte("0123"))
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.getFromBolt([]byte("key"))).Should(BeNil())
+			Ω(l.getReaderFromBolt([]byte("key"))).Should(BeNil())
+		})
+	})
+
+	Context("deleteFromBolt", func() {
+
+		It("should delete chunked values", func() {
+			l := newChunkedLRU()
+			defer closeBoltDB(l)
+			for _, key := range []string{"a1", "a2", "b"} {
+				err := l.put([]byte(key), val)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			err := l.Delete([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.DeletePrefix([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			l.db.View(func(tx *bolt.Tx) error {
+				Ω(tx.Bucket(l.bName).Stats().BucketN).Should(Equal(1))
+				return nil
+			})
+			Ω(l.lru.Len()).Should(Equal(int64(0)))
+		})
+	})
+
+	Context("fillCacheFromBolt", func() {
+
+		It("should fill the cache with chunked values and drop incomplete ones", func() {
+			l := newChunkedLRU()
+			err := l.put([]byte("key"), val)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.db.Update(func(tx *bolt.Tx) error {
+				_, err := tx.Bucket(l.bName).CreateBucket([]byte("incomplete"))
+				return err
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			l = newChunkedLRU()
+			defer closeBoltDB(l)
+			Ω(l.lru.Len()).Should(Equal(int64(1)))
+			Ω(l.lru.Peek([]byte("key"))).Should(Equal(int64(len(val))))
+			l.db.View(func(tx *bolt.Tx) error {
+				Ω(tx.Bucket(l.bName).Bucket([]byte("incomplete"))).Should(BeNil())
+				return nil
+			})
+		})
+	})
+
+	Context("chunkReader", func() {
+
+		It("should read, seek and read at offsets across chunks", func() {
+			r := newChunkReader([][]byte{[]byte("0123"), []byte("4567"), []byte("89")})
+			Ω(r.Size()).Should(Equal(int64(10)))
+			p := make([]byte, 5)
+			n, err := r.ReadAt(p, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(n).Should(Equal(5))
+			Ω(string(p)).Should(Equal("23456"))
+			n, err = r.ReadAt(p, 7)
+			Ω(err).Should(Equal(io.EOF))
+			Ω(n).Should(Equal(3))
+			off, err := r.Seek(-5, io.SeekEnd)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(off).Should(Equal(int64(5)))
+			var buf bytes.Buffer
+			m, err := r.WriteTo(&buf)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(m).Should(Equal(int64(5)))
+			Ω(buf.String()).Should(Equal("56789"))
+			_, err = r.Seek(-1, io.SeekStart)
+			Ω(err).Should(Equal(errNegativeOffset))
+		})
+	})
+})
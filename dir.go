@@ -0,0 +1,164 @@
+package lru
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is the error returned by a DirStore for a key that doesn't map
+// to a file path within its directory.
+var ErrInvalidKey = errors.New("key doesn't map to a file path")
+
+// DirStore is a Store whose values are the files of a directory tree, such as
+// a mounted network file system. Each key is a slash-separated path relative
+// to the directory. Keys that aren't clean relative paths, such as keys
+// containing ".." elements, are rejected with ErrInvalidKey, so that no file
+// outside of the directory is accessed through its keys.
+//
+// A DirStore is a WritableStore, writing each value atomically by renaming a
+// temporary file, and a StreamStore, so that the LRU's GetReader streams large
+// files rather than reading them into memory.
+type DirStore struct {
+	root string
+}
+
+// NewDirStore returns a new DirStore for the directory with the provided path.
+func NewDirStore(root string) *DirStore {
+	return &DirStore{root: root}
+}
+
+// Open checks that the store's directory exists.
+func (s *DirStore) Open() error {
+	fi, err := os.Stat(s.root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.root)
+	}
+	return nil
+}
+
+// Close is a no-op for a DirStore.
+func (s *DirStore) Close() error {
+	return nil
+}
+
+// Get reads the file with the provided key. ErrNotFound is returned if the file
+// doesn't exist or is a directory.
+func (s *DirStore) Get(key []byte) ([]byte, error) {
+	f, _, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// GetStream opens the file with the provided key for streaming, and returns it
+// along with its size.
+func (s *DirStore) GetStream(key []byte) (io.ReadCloser, int64, error) {
+	f, size, err := s.open(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// open opens the file with the provided key and returns it along with its
+// size.
+func (s *DirStore) open(key []byte) (*os.File, int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, 0, ErrNotFound
+	} else if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, 0, ErrNotFound
+	}
+	return f, fi.Size(), nil
+}
+
+// Put writes the provided value into the file with the provided key, creating
+// its parent directories as needed. The value is written and synced into a
+// temporary file that is then renamed, so that the file is never partially
+// written. The file keeps the mode of the file it replaces, or is readable by
+// all users if it is new.
+func (s *DirStore) Put(key, val []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(p); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(val)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Delete removes the file with the provided key. No error is returned if the
+// file doesn't exist.
+func (s *DirStore) Delete(key []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file path of the provided key, or ErrInvalidKey if the key
+// isn't a clean relative path.
+func (s *DirStore) path(key []byte) (string, error) {
+	k := string(key)
+	if k == "" || strings.IndexByte(k, 0) >= 0 || path.Clean("/"+k) != "/"+k {
+		return "", ErrInvalidKey
+	}
+	if filepath.Separator != '/' && strings.ContainsRune(k, filepath.Separator) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(k)), nil
+}
@@ -0,0 +1,140 @@
+package lru
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DirStore", func() {
+
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "dirstore")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Context("Open", func() {
+
+		It("should return an error if the directory doesn't exist", func() {
+			err := NewDirStore(root).Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			err = NewDirStore(filepath.Join(root, "missing")).Open()
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+			err = ioutil.WriteFile(filepath.Join(root, "file"), nil, 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = NewDirStore(filepath.Join(root, "file")).Open()
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("Get", func() {
+
+		It("should read the key's file", func() {
+			s := NewDirStore(root)
+			err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(root, "a", "b", "c"), []byte("value"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := s.Get([]byte("a/b/c"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			_, err = s.Get([]byte("a/b"))
+			Ω(err).Should(Equal(ErrNotFound))
+			_, err = s.Get([]byte("a/missing"))
+			Ω(err).Should(Equal(ErrNotFound))
+		})
+
+		It("should reject keys outside of the directory", func() {
+			s := NewDirStore(filepath.Join(root, "store"))
+			err := ioutil.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+			for _, key := range []string{"", "../secret", "a/../../secret", "/secret", "a//b", "a/", ".", "a\x00b"} {
+				_, err = s.Get([]byte(key))
+				Ω(err).Should(Equal(ErrInvalidKey), key)
+				err = s.Put([]byte(key), []byte("value"))
+				Ω(err).Should(Equal(ErrInvalidKey), key)
+				err = s.Delete([]byte(key))
+				Ω(err).Should(Equal(ErrInvalidKey), key)
+			}
+		})
+	})
+
+	Context("Put", func() {
+
+		It("should write and delete the key's file", func() {
+			s := NewDirStore(root)
+			err := s.Put([]byte("a/b"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := ioutil.ReadFile(filepath.Join(root, "a", "b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			err = s.Put([]byte("a/b"), []byte("new"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err = s.Get([]byte("a/b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("new")))
+			files, err := ioutil.ReadDir(filepath.Join(root, "a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(files).Should(HaveLen(1))
+			Ω(files[0].Mode().Perm()).Should(Equal(os.FileMode(0644)))
+
+			// the mode of a replaced file is kept
+			err = os.Chmod(filepath.Join(root, "a", "b"), 0640)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = s.Put([]byte("a/b"), []byte("newer"))
+			Ω(err).ShouldNot(HaveOccurred())
+			fi, err := os.Stat(filepath.Join(root, "a", "b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fi.Mode().Perm()).Should(Equal(os.FileMode(0640)))
+
+			err = s.Delete([]byte("a/b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = s.Get([]byte("a/b"))
+			Ω(err).Should(Equal(ErrNotFound))
+			err = s.Delete([]byte("a/b"))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("LRU", func() {
+
+		It("should cache and stream files, and write through into them", func() {
+			s := NewDirStore(root)
+			err := s.Put([]byte("big"), make([]byte, 1<<20))
+			Ω(err).ShouldNot(HaveOccurred())
+			l := NewLRU("", "", DefaultTwoQ(1e7), s)
+			err = l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+
+			r, err := l.GetReader([]byte("big"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.Size()).Should(Equal(int64(1 << 20)))
+			v, err := ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(HaveLen(1 << 20))
+			Ω(r.Close()).Should(Succeed())
+			Eventually(func() bool {
+				return l.Contains([]byte("big"))
+			}).Should(BeTrue())
+
+			err = l.Set([]byte("a/b"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err = s.Get([]byte("a/b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			_, err = l.Get([]byte("missing"))
+			Ω(IsNotFound(err)).Should(BeTrue())
+		})
+	})
+})
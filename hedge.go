@@ -0,0 +1,299 @@
+package lru
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHedgePercentile is the default percentile of recent latencies
+	// after which a HedgedStore issues a hedged retrieval.
+	defaultHedgePercentile = 0.95
+
+	// defaultHedgeDelay is the default delay after which a HedgedStore
+	// issues a hedged retrieval until enough latencies are recorded.
+	defaultHedgeDelay = 100 * time.Millisecond
+
+	// hedgeWindow is the number of recent latencies recorded by a
+	// HedgedStore.
+	hedgeWindow = 100
+
+	// minHedgeSamples is the number of latencies a HedgedStore must record
+	// before deriving its delay from them.
+	minHedgeSamples = 10
+
+	// defaultMaxHedgeRate is the default maximum fraction of retrievals a
+	// HedgedStore hedges.
+	defaultMaxHedgeRate = 0.1
+)
+
+// HedgedStore is a Store that wraps another Store and, if a retrieval hasn't
+// completed after a delay, issues a second, hedged retrieval of the same key.
+// The first successful or not found response is returned, and the other
+// retrieval is cancelled through its context if the wrapped store is a
+// ContextStore. The delay is a percentile of the latencies of recent
+// successful retrievals, measured from the start of the first retrieval even if
+// the hedged one completes first. The fraction of retrievals that are hedged is
+// capped, so that a slow wrapped store doesn't receive twice the load.
+//
+// A HedgedStore provides the optional interfaces of the wrapped store, such as
+// WritableStore or StreamStore, but forwards their calls as they are: writes
+// mustn't be duplicated, and streams and batches are too costly to duplicate.
+type HedgedStore struct {
+	store        Store
+	percentile   float64
+	defaultDelay time.Duration
+	maxRate      float64
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring of recent latencies
+	next      int             // index of the next latency in the ring
+	budget    float64         // # of hedged retrievals that may be issued
+	hedges    int64           // # of hedged retrievals issued
+	hedgeWins int64           // # of hedged retrievals returned
+}
+
+// NewHedgedStore returns a new HedgedStore wrapping the provided store. By
+// default, a hedged retrieval is issued after the 95th percentile of the last
+// 100 latencies, or after 100ms until 10 latencies are recorded, for at most
+// 10% of retrievals.
+func NewHedgedStore(store Store) *HedgedStore {
+	s := &HedgedStore{
+		store:        store,
+		percentile:   defaultHedgePercentile,
+		defaultDelay: defaultHedgeDelay,
+	}
+	s.SetMaxHedgeRate(defaultMaxHedgeRate)
+	return s
+}
+
+// SetPercentile sets the percentile, between 0 and 1, of recent latencies after
+// which a hedged retrieval is issued.
+func (s *HedgedStore) SetPercentile(p float64) {
+	if p < 0 {
+		p = 0
+	} else if p > 1 {
+		p = 1
+	}
+	s.percentile = p
+}
+
+// SetDefaultDelay sets the delay after which a hedged retrieval is issued until
+// enough latencies are recorded to derive the delay from them.
+func (s *HedgedStore) SetDefaultDelay(delay time.Duration) {
+	s.defaultDelay = delay
+}
+
+// SetMaxHedgeRate sets the maximum fraction, between 0 and 1, of retrievals that
+// are hedged. Each retrieval allows a fraction of a hedged retrieval, which may
+// be accumulated over the last 100 retrievals. A rate of 0 disables hedging.
+func (s *HedgedStore) SetMaxHedgeRate(rate float64) {
+	if rate < 0 {
+		rate = 0
+	} else if rate > 1 {
+		rate = 1
+	}
+	s.mu.Lock()
+	s.maxRate = rate
+	s.budget = rate * hedgeWindow
+	s.mu.Unlock()
+}
+
+// Open opens the wrapped store.
+func (s *HedgedStore) Open() error {
+	return s.store.Open()
+}
+
+// Close closes the wrapped store.
+func (s *HedgedStore) Close() error {
+	return s.store.Close()
+}
+
+// Get retrieves the value with the provided key from the wrapped store, hedging
+// the retrieval if it is slow.
+func (s *HedgedStore) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// hedgeResult represents the result of one of a HedgedStore's retrievals.
+type hedgeResult struct {
+	val     []byte
+	err     error
+	hedge   bool          // whether the retrieval was the hedged one
+	latency time.Duration // time elapsed since the first retrieval started
+}
+
+// GetContext is like Get, but passes the provided context to the wrapped store
+// if it is a ContextStore.
+func (s *HedgedStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, 2)
+	start := time.Now()
+	get := func(hedge bool) {
+		// recover from a panic by returning an error, as the caller's own
+		// recovery can't reach this goroutine
+		defer func() {
+			if r := recover(); r != nil {
+				results <- hedgeResult{nil, fmt.Errorf("panic: %v", r), hedge, time.Since(start)}
+			}
+		}()
+		val, err := storeGet(ctx, s.store, key)
+		results <- hedgeResult{val, err, hedge, time.Since(start)}
+	}
+	go get(false)
+	s.mu.Lock()
+	if s.budget += s.maxRate; s.budget > s.maxRate*hedgeWindow {
+		s.budget = s.maxRate * hedgeWindow
+	}
+	s.mu.Unlock()
+	t := time.NewTimer(s.delay())
+	defer t.Stop()
+	hedge := t.C
+	pending := 1
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			if !s.allowHedge() {
+				continue
+			}
+			pending++
+			go get(true)
+		case r := <-results:
+			pending--
+			if r.err == nil || IsNotFound(r.err) || pending == 0 {
+				s.record(r)
+				return r.val, r.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// GetMulti retrieves the values with the provided keys from the wrapped store
+// without hedging. If the wrapped store isn't a BatchStore, each value is
+// retrieved with its Get method.
+func (s *HedgedStore) GetMulti(keys [][]byte) ([][]byte, []error) {
+	return storeGetMulti(s.store, keys)
+}
+
+// GetRange retrieves the provided range of the value with the provided key from
+// the wrapped store without hedging. If the wrapped store isn't a RangeStore,
+// the range is sliced from the complete value.
+func (s *HedgedStore) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	return storeGetRange(s.store, key, offset, length)
+}
+
+// GetStream opens the stream of the value with the provided key from the
+// wrapped store without hedging. If the wrapped store isn't a StreamStore, the
+// complete value is retrieved and streamed.
+func (s *HedgedStore) GetStream(key []byte) (io.ReadCloser, int64, error) {
+	return storeGetStream(s.store, key)
+}
+
+// Put writes the provided key and value into the wrapped store. ErrNotWritable
+// is returned if the wrapped store isn't a WritableStore.
+func (s *HedgedStore) Put(key, val []byte) error {
+	return storePut(s.store, key, val)
+}
+
+// Delete deletes the provided key from the wrapped store. ErrNotWritable is
+// returned if the wrapped store isn't a WritableStore.
+func (s *HedgedStore) Delete(key []byte) error {
+	return storeDelete(s.store, key)
+}
+
+// wrapped returns the wrapped store.
+func (s *HedgedStore) wrapped() Store {
+	return s.store
+}
+
+// allowHedge returns true and counts a hedged retrieval if the hedge rate
+// allows one to be issued.
+func (s *HedgedStore) allowHedge() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.budget < 1 {
+		return false
+	}
+	s.budget--
+	s.hedges++
+	return true
+}
+
+// record records the latency of the provided successful result, and whether it
+// was returned by the hedged retrieval.
+func (s *HedgedStore) record(r hedgeResult) {
+	if r.err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.hedge {
+		s.hedgeWins++
+	}
+	if len(s.latencies) < hedgeWindow {
+		s.latencies = append(s.latencies, r.latency)
+		return
+	}
+	s.latencies[s.next] = r.latency
+	s.next = (s.next + 1) % hedgeWindow
+}
+
+// delay returns the delay after which to issue a hedged retrieval.
+func (s *HedgedStore) delay() time.Duration {
+	s.mu.Lock()
+	latencies := append([]time.Duration(nil), s.latencies...)
+	s.mu.Unlock()
+	if len(latencies) < minHedgeSamples {
+		return s.defaultDelay
+	}
+	sort.Sort(durations(latencies))
+	idx := int(math.Ceil(s.percentile*float64(len(latencies)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return latencies[idx]
+}
+
+// durations implements sort.Interface for a slice of durations.
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// StoreStats returns the HedgedStore's current stats, added to those of the
+// wrapped store. Hedges holds the number of hedged retrievals issued and
+// HedgeWins the number of them whose response was returned.
+func (s *HedgedStore) StoreStats() StoreStats {
+	return s.stats(false)
+}
+
+// ResetStoreStats resets the HedgedStore's stats, along with those of the
+// wrapped store, and returns its stats as they were immediately before being
+// reset. The recorded latencies are kept.
+func (s *HedgedStore) ResetStoreStats() StoreStats {
+	return s.stats(true)
+}
+
+// stats returns the HedgedStore's current stats, and resets them if reset is
+// true.
+func (s *HedgedStore) stats(reset bool) StoreStats {
+	stats := storeStats(s.store, reset)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Hedges += s.hedges
+	stats.HedgeWins += s.hedgeWins
+	if reset {
+		s.hedges, s.hedgeWins = 0, 0
+	}
+	return stats
+}
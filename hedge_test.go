@@ -0,0 +1,183 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HedgedStore", func() {
+
+	Context("Get", func() {
+
+		It("should return the hedged response and cancel the slow retrieval", func() {
+			var calls int32
+			cancelled := make(chan struct{})
+			st := newContextStore(func(ctx context.Context, key []byte) ([]byte, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					<-ctx.Done()
+					close(cancelled)
+					return nil, ctx.Err()
+				}
+				return []byte("hedged"), nil
+			})
+			s := NewHedgedStore(st)
+			s.SetDefaultDelay(5 * time.Millisecond)
+			v, err := s.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("hedged")))
+			Eventually(cancelled).Should(BeClosed())
+			stats := s.StoreStats()
+			Ω(stats.Hedges).Should(Equal(int64(1)))
+			Ω(stats.HedgeWins).Should(Equal(int64(1)))
+			// the latency includes the delay before the hedged retrieval
+			Ω(s.latencies).Should(HaveLen(1))
+			Ω(s.latencies[0]).Should(BeNumerically(">=", 5*time.Millisecond))
+		})
+
+		It("should cap the fraction of retrievals that are hedged", func() {
+			var calls int32
+			st := newStore(func(key []byte) ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return []byte("value"), nil
+			})
+			s := NewHedgedStore(st)
+			s.SetDefaultDelay(time.Millisecond)
+			s.SetMaxHedgeRate(0.01)
+			for i := 0; i < 3; i++ {
+				v, err := s.Get([]byte("key"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(v).Should(Equal([]byte("value")))
+			}
+			Ω(s.StoreStats().Hedges).Should(Equal(int64(1)))
+
+			s.SetMaxHedgeRate(0)
+			_, err := s.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(s.StoreStats().Hedges).Should(Equal(int64(1)))
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&calls)
+			}).Should(Equal(int32(5)))
+		})
+
+		It("should not hedge a fast retrieval", func() {
+			var calls int32
+			st := newStore(func(key []byte) ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				return nil, ErrNotFound
+			})
+			s := NewHedgedStore(st)
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(Equal(ErrNotFound))
+			Ω(atomic.LoadInt32(&calls)).Should(Equal(int32(1)))
+			Ω(s.StoreStats().Hedges).Should(Equal(int64(0)))
+		})
+
+		It("should wait for the other retrieval when one fails", func() {
+			var calls int32
+			st := newStore(func(key []byte) ([]byte, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					time.Sleep(20 * time.Millisecond)
+					return []byte("value"), nil
+				}
+				return nil, errors.New("test error")
+			})
+			s := NewHedgedStore(st)
+			s.SetDefaultDelay(time.Millisecond)
+			v, err := s.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			stats := s.ResetStoreStats()
+			Ω(stats.Hedges).Should(Equal(int64(1)))
+			Ω(stats.HedgeWins).Should(Equal(int64(0)))
+			Ω(s.StoreStats().Hedges).Should(Equal(int64(0)))
+		})
+
+		It("should return the error once both retrievals fail", func() {
+			st := newStore(func(key []byte) ([]byte, error) {
+				time.Sleep(5 * time.Millisecond)
+				return nil, errors.New("test error")
+			})
+			s := NewHedgedStore(st)
+			s.SetDefaultDelay(time.Millisecond)
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(MatchError("test error"))
+		})
+	})
+
+	Context("panic", func() {
+
+		It("should return a panicking store's panic as an error", func() {
+			st := newStore(func(key []byte) ([]byte, error) {
+				panic("test panic")
+			})
+			s := NewHedgedStore(st)
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(MatchError("panic: test panic"))
+
+			l := NewLRU("", "", DefaultTwoQ(0), s)
+			err = l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			_, err = l.Get([]byte("key"))
+			Ω(err).Should(MatchError("panic: test panic"))
+		})
+	})
+
+	Context("optional interfaces", func() {
+
+		It("should forward the wrapped store's interfaces without hedging", func() {
+			ws := newWritableStore()
+			s := NewHedgedStore(ws)
+			s.SetDefaultDelay(0)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeTrue())
+			_, ok = streamStore(s)
+			Ω(ok).Should(BeFalse())
+			err := s.Put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = s.Delete([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.ops()).Should(Equal([]string{"put key", "delete key"}))
+			Ω(s.StoreStats().Hedges).Should(Equal(int64(0)))
+
+			_, ok = writableStore(NewHedgedStore(newStore(nil)))
+			Ω(ok).Should(BeFalse())
+			err = NewHedgedStore(newStore(nil)).Put([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+
+			// the interfaces are provided through nested wrappers
+			_, ok = streamStore(NewHedgedStore(NewRetryStore(NewDirStore(""))))
+			Ω(ok).Should(BeTrue())
+			_, ok = streamStore(NewHedgedStore(NewRetryStore(ws)))
+			Ω(ok).Should(BeFalse())
+		})
+	})
+
+	Context("delay", func() {
+
+		It("should derive the delay from recent latencies", func() {
+			s := NewHedgedStore(nil)
+			s.SetDefaultDelay(time.Second)
+			for i := 1; i < minHedgeSamples; i++ {
+				s.record(hedgeResult{latency: time.Duration(i) * time.Millisecond})
+			}
+			Ω(s.delay()).Should(Equal(time.Second))
+			for i := minHedgeSamples; i <= hedgeWindow; i++ {
+				s.record(hedgeResult{latency: time.Duration(i) * time.Millisecond})
+			}
+			Ω(s.delay()).Should(Equal(95 * time.Millisecond))
+			s.SetPercentile(0.5)
+			Ω(s.delay()).Should(Equal(50 * time.Millisecond))
+			for i := 0; i < hedgeWindow; i++ {
+				s.record(hedgeResult{latency: time.Millisecond})
+			}
+			Ω(s.delay()).Should(Equal(time.Millisecond))
+		})
+	})
+})
@@ -0,0 +1,244 @@
+package lru
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHTTPValidators is the maximum number of validators an HTTPStore keeps to
+// revalidate stale values.
+const maxHTTPValidators = 10000
+
+// HTTPError is the error returned by an HTTPStore when the origin responds with
+// an unexpected status code. An HTTPError with a 404 or 410 status code is a
+// not found error, as reported by IsNotFound.
+type HTTPError struct {
+	URL        string // the requested URL
+	StatusCode int    // the response's status code
+}
+
+// Error returns the error's message.
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.StatusCode, e.URL)
+}
+
+// NotFound returns true if the error's status code indicates that no value
+// exists for the requested key.
+func (e *HTTPError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
+
+// HTTPStore is a Store retrieving values from an HTTP origin. Each key is
+// mapped to a URL by replacing "{key}" in a URL template with the key, escaped
+// as a URL path with its slashes preserved.
+//
+// When an LRU retrieves a value it still holds once expired, whether refreshing
+// it within the stale grace period or not, an HTTPStore revalidates it with a
+// conditional request, using the ETag or Last-Modified header of the response
+// that last returned the value. The held value is only revalidated if it is
+// identical to the value that response returned, and not a value written into
+// the LRU by other means, such as Put or Set. The TTL of each retrieved value
+// is set by the response's Cache-Control s-maxage or max-age directive, if any.
+type HTTPStore struct {
+	tmpl   string
+	client *http.Client
+	header http.Header
+
+	mu         sync.Mutex
+	validators map[string]httpValidator
+}
+
+// httpValidator holds the validators of a value returned by an HTTP origin.
+type httpValidator struct {
+	etag         string
+	lastModified string
+	sum          [sha256.Size]byte // checksum of the validated value
+}
+
+// NewHTTPStore returns a new HTTPStore with the provided URL template, such as
+// "https://example.com/values/{key}". By default, http.DefaultClient is used.
+func NewHTTPStore(tmpl string) *HTTPStore {
+	return &HTTPStore{
+		tmpl:       tmpl,
+		client:     http.DefaultClient,
+		header:     make(http.Header),
+		validators: make(map[string]httpValidator),
+	}
+}
+
+// SetClient sets the HTTP client used to make requests, e.g. to set a timeout
+// or a custom transport.
+func (s *HTTPStore) SetClient(client *http.Client) {
+	s.client = client
+}
+
+// SetHeader sets a header sent with every request, replacing any existing
+// value.
+func (s *HTTPStore) SetHeader(key, value string) {
+	s.header.Set(key, value)
+}
+
+// SetBasicAuth sets the username and password sent with every request using
+// HTTP basic authentication.
+func (s *HTTPStore) SetBasicAuth(username, password string) {
+	r := &http.Request{Header: make(http.Header)}
+	r.SetBasicAuth(username, password)
+	s.header.Set("Authorization", r.Header.Get("Authorization"))
+}
+
+// Open is a no-op for an HTTPStore.
+func (s *HTTPStore) Open() error {
+	return nil
+}
+
+// Close is a no-op for an HTTPStore.
+func (s *HTTPStore) Close() error {
+	return nil
+}
+
+// Get retrieves the value with the provided key from the origin.
+func (s *HTTPStore) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but cancels the request once the provided context is
+// done.
+func (s *HTTPStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	u := s.url(key)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+
+	// revalidate the stale value held by the LRU, if any
+	var stale []byte
+	if v, ok := s.validator(key); ok {
+		if stale = StaleValue(ctx); stale != nil && sha256.Sum256(stale) != v.sum {
+			// the held value isn't the one the validators apply to
+			stale = nil
+		}
+		if stale != nil {
+			if v.etag != "" {
+				req.Header.Set("If-None-Match", v.etag)
+			}
+			if v.lastModified != "" {
+				req.Header.Set("If-Modified-Since", v.lastModified)
+			}
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && stale != nil:
+		setHTTPTTL(ctx, resp.Header)
+		return stale, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		val, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		s.setValidator(key, resp.Header, val)
+		setHTTPTTL(ctx, resp.Header)
+		return val, nil
+	}
+	// drain the body so that the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	herr := &HTTPError{URL: u, StatusCode: resp.StatusCode}
+	if herr.NotFound() {
+		s.setValidator(key, nil, nil)
+	}
+	return nil, herr
+}
+
+// url returns the URL of the provided key.
+func (s *HTTPStore) url(key []byte) string {
+	path := (&url.URL{Path: string(key)}).EscapedPath()
+	return strings.Replace(s.tmpl, "{key}", path, -1)
+}
+
+// validator returns the validator of the value with the provided key, if any.
+func (s *HTTPStore) validator(key []byte) (httpValidator, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.validators[string(key)]
+	return v, ok
+}
+
+// setValidator sets the validator of the provided value with the provided key
+// from the provided response header, or removes it if the header has none. If
+// too many validators are kept, an arbitrary one is dropped.
+func (s *HTTPStore) setValidator(key []byte, h http.Header, val []byte) {
+	v := httpValidator{
+		etag:         h.Get("ETag"),
+		lastModified: h.Get("Last-Modified"),
+	}
+	if v.etag != "" || v.lastModified != "" {
+		v.sum = sha256.Sum256(val)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v.etag == "" && v.lastModified == "" {
+		delete(s.validators, string(key))
+		return
+	}
+	if _, ok := s.validators[string(key)]; !ok && len(s.validators) >= maxHTTPValidators {
+		for k := range s.validators {
+			delete(s.validators, k)
+			break
+		}
+	}
+	s.validators[string(key)] = v
+}
+
+// setHTTPTTL sets the TTL of the value being retrieved from the s-maxage or
+// max-age directive of the provided response header's Cache-Control, if any.
+// A max-age of 0 causes the value to expire immediately, so that it is
+// revalidated once requested again within the LRU's stale grace period.
+func setHTTPTTL(ctx context.Context, h http.Header) {
+	var maxAge, sMaxAge = -1, -1
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(d), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(strings.Trim(kv[1], `"`))
+		if err != nil || n < 0 {
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "max-age":
+			maxAge = n
+		case "s-maxage":
+			sMaxAge = n
+		}
+	}
+	if sMaxAge >= 0 {
+		maxAge = sMaxAge
+	}
+	if maxAge < 0 {
+		return
+	}
+	ttl := time.Duration(maxAge) * time.Second
+	if ttl == 0 {
+		// a TTL that is not positive disables expiration
+		ttl = time.Nanosecond
+	}
+	SetValueTTL(ctx, ttl)
+}
@@ -0,0 +1,217 @@
+package lru
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPStore", func() {
+
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+		conns    int32
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		atomic.StoreInt32(&conns, 0)
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, r)
+			mu.Unlock()
+			switch r.URL.Path {
+			case "/values/missing":
+				http.NotFound(w, r)
+			case "/values/broken":
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(make([]byte, 1024))
+			case "/values/fresh":
+				w.Header().Set("Cache-Control", "public, max-age=60")
+				w.Write([]byte("fresh"))
+			case "/values/etag":
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Cache-Control", "max-age=0")
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.Header().Set("Cache-Control", "max-age=60")
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Write([]byte("etag"))
+			default:
+				w.Write([]byte("value " + r.URL.Path))
+			}
+		}))
+		server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		server.Start()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	expiryOf := func(l *LRU, key string) func() time.Time {
+		return func() time.Time {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return l.expires[key]
+		}
+	}
+
+	lastRequest := func() *http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[len(requests)-1]
+	}
+
+	Context("Get", func() {
+
+		It("should retrieve the value from the key's URL", func() {
+			s := NewHTTPStore(server.URL + "/values/{key}")
+			s.SetHeader("X-Test", "test")
+			s.SetBasicAuth("user", "pass")
+			v, err := s.Get([]byte("a b/c"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value /values/a b/c")))
+			r := lastRequest()
+			Ω(r.RequestURI).Should(Equal("/values/a%20b/c"))
+			Ω(r.Header.Get("X-Test")).Should(Equal("test"))
+			user, pass, ok := r.BasicAuth()
+			Ω(ok).Should(BeTrue())
+			Ω(user).Should(Equal("user"))
+			Ω(pass).Should(Equal("pass"))
+		})
+
+		It("should return a typed error for unexpected statuses", func() {
+			s := NewHTTPStore(server.URL + "/values/{key}")
+			_, err := s.Get([]byte("missing"))
+			Ω(IsNotFound(err)).Should(BeTrue())
+			Ω(err.(*HTTPError).StatusCode).Should(Equal(http.StatusNotFound))
+			_, err = s.Get([]byte("broken"))
+			Ω(IsNotFound(err)).Should(BeFalse())
+			Ω(err).Should(MatchError("unexpected status 500 from " + server.URL + "/values/broken"))
+		})
+
+		It("should reuse the connection after an unexpected status", func() {
+			s := NewHTTPStore(server.URL + "/values/{key}")
+			for i := 0; i < 3; i++ {
+				_, err := s.Get([]byte("broken"))
+				Ω(err).Should(HaveOccurred())
+			}
+			Ω(atomic.LoadInt32(&conns)).Should(Equal(int32(1)))
+		})
+
+		It("should stop once the context is done", func() {
+			s := NewHTTPStore(server.URL + "/values/{key}")
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := s.GetContext(ctx, []byte("key"))
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("LRU", func() {
+
+		It("should cache values with their max-age as TTL", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), NewRetryStore(NewHTTPStore(server.URL+"/values/{key}")))
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			v, err := l.Get([]byte("fresh"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("fresh")))
+			Eventually(expiryOf(l, "fresh")).Should(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+
+		It("should revalidate stale values with a conditional request", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), NewHTTPStore(server.URL+"/values/{key}"))
+			l.SetStaleGrace(time.Hour)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			v, err := l.Get([]byte("etag"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("etag")))
+			Eventually(expiryOf(l, "etag")).ShouldNot(BeZero())
+
+			// the stale value is returned and revalidated in the background
+			v, err = l.Get([]byte("etag"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("etag")))
+			Eventually(expiryOf(l, "etag")).Should(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+			r := lastRequest()
+			Ω(r.Header.Get("If-None-Match")).Should(Equal(`"v1"`))
+			Ω(l.getFromBolt([]byte("etag"))).Should(Equal([]byte("etag")))
+		})
+
+		It("should revalidate expired values without a stale grace period", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), NewHTTPStore(server.URL+"/values/{key}"))
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			v, err := l.Get([]byte("etag"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("etag")))
+			Eventually(expiryOf(l, "etag")).ShouldNot(BeZero())
+
+			// the expired value is a miss, revalidated before being returned
+			v, err = l.Get([]byte("etag"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("etag")))
+			r := lastRequest()
+			Ω(r.Header.Get("If-None-Match")).Should(Equal(`"v1"`))
+			Eventually(expiryOf(l, "etag")).Should(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+
+		It("should not revalidate values written into the LRU", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), NewHTTPStore(server.URL+"/values/{key}"))
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			_, err = l.Get([]byte("etag"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(expiryOf(l, "etag")).ShouldNot(BeZero())
+			err = l.PutWithTTL([]byte("etag"), []byte("local"), time.Nanosecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			time.Sleep(time.Millisecond)
+
+			// the expired local value is replaced by the origin's value
+			v, err := l.Get([]byte("etag"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("etag")))
+			r := lastRequest()
+			Ω(r.Header.Get("If-None-Match")).Should(BeEmpty())
+		})
+	})
+
+	Context("setHTTPTTL", func() {
+
+		It("should prefer s-maxage to max-age", func() {
+			ttlOf := func(cc string) time.Duration {
+				r := newReq(0)
+				h := make(http.Header)
+				h.Set("Cache-Control", cc)
+				setHTTPTTL(r.ctx, h)
+				ttl, _ := r.hints.valueTTL()
+				return ttl
+			}
+			Ω(ttlOf("max-age=10")).Should(Equal(10 * time.Second))
+			Ω(ttlOf(`max-age="10", s-maxage=20`)).Should(Equal(20 * time.Second))
+			Ω(ttlOf("max-age=0")).Should(Equal(time.Nanosecond))
+			Ω(ttlOf("no-cache, max-age=x")).Should(Equal(time.Duration(0)))
+		})
+	})
+})
@@ -0,0 +1,401 @@
+package lru
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// journal operations
+const (
+	journalPut = iota + 1
+	journalDelete
+
+	// journalPutChunked is a put whose value is stored as a sequence of
+	// chunks in the journal values bucket, keyed by the put's sequence
+	// number, rather than within the journal entry.
+	journalPutChunked
+)
+
+const (
+	// minFlushBackoff is the initial delay before retrying a failed flush of
+	// the journal.
+	minFlushBackoff = 100 * time.Millisecond
+
+	// maxFlushBackoff is the maximum delay before retrying a failed flush
+	// of the journal.
+	maxFlushBackoff = time.Minute
+)
+
+// errInvalidJournal is the error returned when a journal entry can't be
+// decoded.
+var errInvalidJournal = errors.New("invalid journal entry")
+
+// journalEntry represents a remote store write queued in the journal.
+type journalEntry struct {
+	op   byte      // the write's operation (i.e. put, delete)
+	time time.Time // the time at which the write was queued
+	key  []byte    // the written key
+	val  []byte    // the written value, if any
+}
+
+// newJournalEntry returns a new journal entry with the provided operation, key
+// and value, queued at the current time.
+func newJournalEntry(op byte, key, val []byte) *journalEntry {
+	return &journalEntry{op: op, time: time.Now(), key: key, val: val}
+}
+
+// result returns the value the remote store holds once the entry's write is
+// flushed, or ErrNotFound if the write is a deletion.
+func (e *journalEntry) result() ([]byte, error) {
+	if e.op == journalDelete {
+		return nil, ErrNotFound
+	}
+	return e.val, nil
+}
+
+// putJournal queues the provided remote store write in the journal within the
+// provided transaction, so that it is only queued if the transaction commits.
+// The key is marked as pending once the transaction commits.
+func (l *LRU) putJournal(tx *bolt.Tx, e *journalEntry) error {
+	seq, err := tx.Bucket(l.jName).NextSequence()
+	if err != nil {
+		return err
+	}
+	return l.queueJournal(tx, seq, e)
+}
+
+// reserveJournal reserves the sequence number of a chunked put within the
+// provided transaction, and creates the nested bucket of its value's chunks in
+// the journal values bucket.
+func (l *LRU) reserveJournal(tx *bolt.Tx) (uint64, error) {
+	seq, err := tx.Bucket(l.jName).NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Bucket(l.vName).CreateBucket(encodeSeq(seq)); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// queueJournal queues the provided remote store write in the journal with the
+// provided sequence number within the provided transaction, as putJournal
+// does.
+func (l *LRU) queueJournal(tx *bolt.Tx, seq uint64, e *journalEntry) error {
+	if err := tx.Bucket(l.jName).Put(encodeSeq(seq), encodeJournal(e)); err != nil {
+		return err
+	}
+	key := string(e.key)
+	tx.OnCommit(func() {
+		l.muPending.Lock()
+		l.pending[key] = seq
+		l.muPending.Unlock()
+	})
+	return nil
+}
+
+// loadPending marks the keys of all writes in the provided journal bucket as
+// pending, such as writes left unflushed when the LRU was last closed.
+func (l *LRU) loadPending(jb *bolt.Bucket) {
+	l.muPending.Lock()
+	defer l.muPending.Unlock()
+	c := jb.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if e, err := decodeJournal(v); err == nil && len(k) == 8 {
+			l.pending[string(e.key)] = binary.BigEndian.Uint64(k)
+		}
+	}
+}
+
+// isPending returns true if a write of the provided key is queued in the
+// journal.
+func (l *LRU) isPending(key []byte) bool {
+	l.muPending.Lock()
+	_, ok := l.pending[string(key)]
+	l.muPending.Unlock()
+	return ok
+}
+
+// pendingWrite returns the latest write of the provided key queued in the
+// journal, or nil if there is none. Until it is flushed, the remote store
+// still holds the key's previous value, so retrievals of the key are served
+// from the write instead.
+func (l *LRU) pendingWrite(key []byte) *journalEntry {
+	l.muPending.Lock()
+	seq, ok := l.pending[string(key)]
+	l.muPending.Unlock()
+	if !ok {
+		return nil
+	}
+	var e *journalEntry
+	l.db.View(func(tx *bolt.Tx) error {
+		// the write may have been flushed in the meantime
+		k := encodeSeq(seq)
+		if v := tx.Bucket(l.jName).Get(k); v != nil {
+			if je, err := l.readJournal(tx, k, v); err == nil {
+				e = &je
+			}
+		}
+		return nil
+	})
+	return e
+}
+
+// readJournal decodes the provided journal entry with the provided key within
+// the provided transaction, reading its value from the journal values bucket
+// if it is chunked.
+func (l *LRU) readJournal(tx *bolt.Tx, k, v []byte) (journalEntry, error) {
+	e, err := decodeJournal(v)
+	if err != nil || e.op != journalPutChunked {
+		return e, err
+	}
+	chunks := getChunks(tx.Bucket(l.vName), k)
+	if chunks == nil {
+		return journalEntry{}, errInvalidJournal
+	}
+	e.val = joinChunks(chunks)
+	return e, nil
+}
+
+// deleteJournalValue deletes the chunked value of the journal entry with the
+// provided key within the provided transaction, if it has one.
+func (l *LRU) deleteJournalValue(tx *bolt.Tx, k []byte) error {
+	vb := tx.Bucket(l.vName)
+	if vb.Bucket(k) == nil {
+		return nil
+	}
+	return vb.DeleteBucket(k)
+}
+
+// deleteOrphanValues deletes the chunked values from the provided journal
+// values bucket whose journal entries aren't in the provided journal bucket,
+// such as the values of chunked puts that failed before being queued.
+func deleteOrphanValues(jb, vb *bolt.Bucket) error {
+	var orphans [][]byte
+	c := vb.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if jb.Get(k) == nil {
+			orphans = append(orphans, append([]byte(nil), k...))
+		}
+	}
+	for _, k := range orphans {
+		if err := vb.DeleteBucket(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearPending unmarks the provided key as pending once its write with the
+// provided sequence number is flushed, unless a later write of the key is
+// queued.
+func (l *LRU) clearPending(key []byte, seq uint64) {
+	l.muPending.Lock()
+	if l.pending[string(key)] == seq {
+		delete(l.pending, string(key))
+	}
+	l.muPending.Unlock()
+}
+
+// signalFlush signals the background flush that the journal has new entries,
+// without blocking.
+func (l *LRU) signalFlush() {
+	select {
+	case l.flushSig <- struct{}{}:
+	default:
+	}
+}
+
+// journalStats returns the number of remote store writes queued in the
+// journal and the time elapsed since the oldest of them was queued.
+func (l *LRU) journalStats() (depth int64, age time.Duration) {
+	if l.db == nil {
+		return 0, 0
+	}
+	l.db.View(func(tx *bolt.Tx) error {
+		jb := tx.Bucket(l.jName)
+		if jb == nil {
+			return nil
+		}
+		depth = int64(jb.Stats().KeyN)
+		if _, v := jb.Cursor().First(); v != nil {
+			if e, err := decodeJournal(v); err == nil {
+				age = time.Since(e.time)
+			}
+		}
+		return nil
+	})
+	return depth, age
+}
+
+// flushJournal writes the queued remote store writes into the remote store in
+// order, deleting each from the journal once written, and returns the first
+// error encountered. Entries that can't be decoded are deleted without being
+// written, as are writes that failed permanently or too many times.
+func (l *LRU) flushJournal() error {
+	l.muFlush.Lock()
+	defer l.muFlush.Unlock()
+	for {
+		var seq []byte
+		var e journalEntry
+		var derr error
+		err := l.db.View(func(tx *bolt.Tx) error {
+			k, v := tx.Bucket(l.jName).Cursor().First()
+			if k == nil {
+				return nil
+			}
+			seq = append([]byte(nil), k...)
+			e, derr = l.readJournal(tx, k, v)
+			return nil
+		})
+		if err != nil || seq == nil {
+			return err
+		}
+		if derr == nil {
+			// keep the journal for a store that can be written into,
+			// such as the next time the LRU is opened
+			ws, ok := writableStore(l.store)
+			if !ok {
+				return ErrNotWritable
+			}
+			if err := writeToStore(ws, e); err != nil && !l.dropWrite(seq, err) {
+				return err
+			}
+		}
+		err = l.db.Update(func(tx *bolt.Tx) error {
+			if err := l.deleteJournalValue(tx, seq); err != nil {
+				return err
+			}
+			return tx.Bucket(l.jName).Delete(seq)
+		})
+		if err != nil {
+			return err
+		}
+		n := binary.BigEndian.Uint64(seq)
+		if derr == nil {
+			l.clearPending(e.key, n)
+		}
+		l.mu.Lock()
+		if l.jfailSeq == n {
+			l.jfails = 0
+		}
+		l.mu.Unlock()
+	}
+}
+
+// dropWrite records the provided error as a failure to flush the queued write
+// with the provided sequence number, and returns true if the write should be
+// dropped from the journal rather than retried. Writes the store rejects with
+// ErrNotWritable are always dropped.
+func (l *LRU) dropWrite(seq []byte, err error) bool {
+	n := binary.BigEndian.Uint64(seq)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.jfailSeq != n {
+		l.jfailSeq, l.jfails = n, 0
+	}
+	l.jfails++
+	if err != ErrNotWritable && (l.maxFlush <= 0 || l.jfails < int64(l.maxFlush)) {
+		return false
+	}
+	l.jdropped++
+	return true
+}
+
+// writeToStore writes the provided journal entry into the provided store.
+func writeToStore(ws WritableStore, e journalEntry) error {
+	if e.op == journalDelete {
+		// the key is already deleted if the store doesn't hold it
+		if err := ws.Delete(e.key); !IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	return ws.Put(e.key, e.val)
+}
+
+// flushInBackground flushes the journal in a background goroutine whenever it
+// has new entries, until the LRU is closed. Failed flushes are retried with an
+// exponential backoff.
+func (l *LRU) flushInBackground() {
+	quit := l.quit
+	// replay any writes left unflushed when the LRU was last closed, or
+	// when the process last exited
+	l.signalFlush()
+	l.bg.Add(1)
+	go func() {
+		defer l.bg.Done()
+		var backoff time.Duration
+		retry := time.NewTimer(0)
+		defer retry.Stop()
+		<-retry.C
+		for {
+			select {
+			case <-quit:
+				return
+			case <-l.flushSig:
+			case <-retry.C:
+			}
+			if err := l.flushJournal(); err == nil {
+				backoff = 0
+				continue
+			}
+			if backoff *= 2; backoff < minFlushBackoff {
+				backoff = minFlushBackoff
+			} else if backoff > maxFlushBackoff {
+				backoff = maxFlushBackoff
+			}
+			if !retry.Stop() {
+				select {
+				case <-retry.C:
+				default:
+				}
+			}
+			retry.Reset(backoff)
+		}
+	}()
+}
+
+// encodeSeq encodes the provided journal sequence number as a journal key.
+func encodeSeq(seq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+	return b
+}
+
+// encodeJournal encodes the provided journal entry as its operation, the Unix
+// time in nanoseconds at which it was queued, the uvarint length of its key,
+// its key and its value.
+func encodeJournal(e *journalEntry) []byte {
+	b := make([]byte, 9+binary.MaxVarintLen64, 9+binary.MaxVarintLen64+len(e.key)+len(e.val))
+	b[0] = e.op
+	binary.BigEndian.PutUint64(b[1:], uint64(e.time.UnixNano()))
+	n := binary.PutUvarint(b[9:], uint64(len(e.key)))
+	b = append(b[:9+n], e.key...)
+	return append(b, e.val...)
+}
+
+// decodeJournal decodes a journal entry encoded by encodeJournal. The key and
+// value are copied.
+func decodeJournal(b []byte) (journalEntry, error) {
+	if len(b) < 9 || b[0] < journalPut || b[0] > journalPutChunked {
+		return journalEntry{}, errInvalidJournal
+	}
+	klen, n := binary.Uvarint(b[9:])
+	if n <= 0 || klen == 0 || klen > uint64(len(b)-9-n) {
+		return journalEntry{}, errInvalidJournal
+	}
+	e := journalEntry{
+		op:   b[0],
+		time: time.Unix(0, int64(binary.BigEndian.Uint64(b[1:]))),
+	}
+	b = b[9+n:]
+	e.key = append([]byte(nil), b[:klen]...)
+	if e.op == journalPut {
+		e.val = append([]byte{}, b[klen:]...)
+	}
+	return e, nil
+}
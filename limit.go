@@ -0,0 +1,306 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrStoreBusy is the error returned by a LimitStore when it rejects a
+// retrieval because its queue is full.
+var ErrStoreBusy = errors.New("remote store is busy")
+
+// LimitStore is a Store that wraps another Store, limiting the number of
+// concurrent retrievals and the rate at which they start. Retrievals exceeding
+// either limit wait in a queue, or fail with ErrStoreBusy if the queue is full.
+//
+// A LimitStore provides the optional interfaces of the wrapped store, such as
+// WritableStore or StreamStore, and their calls count towards the same limits
+// as retrievals. A stream holds its slot of concurrent retrievals until it is
+// closed.
+type LimitStore struct {
+	store    Store
+	sem      chan struct{} // slots of concurrent retrievals, nil if unlimited
+	rate     float64       // tokens added per second, 0 if unlimited
+	burst    float64       // maximum number of tokens
+	maxQueue int           // maximum # of waiting retrievals, < 0 if unlimited
+
+	mu       sync.Mutex
+	tokens   float64   // tokens currently available, negative if reserved
+	last     time.Time // time at which tokens were last added
+	queued   int64     // # of retrievals currently waiting
+	rejected int64     // # of retrievals rejected
+}
+
+// NewLimitStore returns a new LimitStore wrapping the provided store and
+// allowing at most the provided number of concurrent retrievals, or any number
+// if it is not positive. By default, the rate of retrievals isn't limited and
+// the queue is unbounded.
+func NewLimitStore(store Store, concurrency int) *LimitStore {
+	s := &LimitStore{store: store, maxQueue: -1}
+	if concurrency > 0 {
+		s.sem = make(chan struct{}, concurrency)
+	}
+	return s
+}
+
+// SetRateLimit sets the rate, in retrievals per second, at which retrievals may
+// start, using a token bucket holding up to burst tokens. A rate that is not
+// positive disables rate limiting. This method must be called before the store
+// is used.
+func (s *LimitStore) SetRateLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	s.rate, s.burst = rate, float64(burst)
+	s.tokens, s.last = s.burst, time.Now()
+}
+
+// SetMaxQueue sets the maximum number of retrievals waiting for the limits to
+// allow them, beyond which retrievals fail with ErrStoreBusy. A value of 0
+// rejects all retrievals that can't start immediately, while a negative value,
+// which is the default, queues all of them.
+func (s *LimitStore) SetMaxQueue(n int) {
+	s.maxQueue = n
+}
+
+// Open opens the wrapped store.
+func (s *LimitStore) Open() error {
+	return s.store.Open()
+}
+
+// Close closes the wrapped store.
+func (s *LimitStore) Close() error {
+	return s.store.Close()
+}
+
+// Get retrieves the value with the provided key from the wrapped store once
+// the limits allow it.
+func (s *LimitStore) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but passes the provided context to the wrapped store
+// if it is a ContextStore, and stops waiting in the queue once the context is
+// done.
+func (s *LimitStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if err := s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer s.release()
+	return storeGet(ctx, s.store, key)
+}
+
+// GetMulti retrieves the values with the provided keys from the wrapped store
+// once the limits allow it, counting the batch as a single retrieval. If the
+// wrapped store isn't a BatchStore, each value is retrieved with its Get
+// method.
+func (s *LimitStore) GetMulti(keys [][]byte) ([][]byte, []error) {
+	if err := s.acquire(context.Background()); err != nil {
+		errs := make([]error, len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([][]byte, len(keys)), errs
+	}
+	defer s.release()
+	return storeGetMulti(s.store, keys)
+}
+
+// GetRange retrieves the provided range of the value with the provided key from
+// the wrapped store once the limits allow it. If the wrapped store isn't a
+// RangeStore, the range is sliced from the complete value.
+func (s *LimitStore) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	if err := s.acquire(context.Background()); err != nil {
+		return nil, err
+	}
+	defer s.release()
+	return storeGetRange(s.store, key, offset, length)
+}
+
+// GetStream opens the stream of the value with the provided key from the
+// wrapped store once the limits allow it. The stream's slot is released once
+// the stream is closed. If the wrapped store isn't a StreamStore, the complete
+// value is retrieved and streamed.
+func (s *LimitStore) GetStream(key []byte) (io.ReadCloser, int64, error) {
+	if err := s.acquire(context.Background()); err != nil {
+		return nil, 0, err
+	}
+	rc, size, err := storeGetStream(s.store, key)
+	if err != nil || rc == nil {
+		s.release()
+		return rc, size, err
+	}
+	return &limitedStream{ReadCloser: rc, release: s.release}, size, nil
+}
+
+// Put writes the provided key and value into the wrapped store once the limits
+// allow it. ErrNotWritable is returned if the wrapped store isn't a
+// WritableStore.
+func (s *LimitStore) Put(key, val []byte) error {
+	if _, ok := writableStore(s.store); !ok {
+		return ErrNotWritable
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		return err
+	}
+	defer s.release()
+	return storePut(s.store, key, val)
+}
+
+// Delete deletes the provided key from the wrapped store once the limits allow
+// it. ErrNotWritable is returned if the wrapped store isn't a WritableStore.
+func (s *LimitStore) Delete(key []byte) error {
+	if _, ok := writableStore(s.store); !ok {
+		return ErrNotWritable
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		return err
+	}
+	defer s.release()
+	return storeDelete(s.store, key)
+}
+
+// wrapped returns the wrapped store.
+func (s *LimitStore) wrapped() Store {
+	return s.store
+}
+
+// limitedStream is a stream opened by a LimitStore, releasing its slot of
+// concurrent retrievals once closed.
+type limitedStream struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the stream and releases its slot.
+func (ls *limitedStream) Close() error {
+	err := ls.ReadCloser.Close()
+	ls.once.Do(ls.release)
+	return err
+}
+
+// acquire waits until a retrieval is allowed to start, queueing it if needed.
+// On success, the retrieval's slot must be released once it completes.
+func (s *LimitStore) acquire(ctx context.Context) error {
+	wait := s.reserve()
+	if wait == 0 && s.trySlot() {
+		return nil
+	}
+	s.mu.Lock()
+	if s.maxQueue >= 0 && s.queued >= int64(s.maxQueue) {
+		s.rejected++
+		s.refund()
+		s.mu.Unlock()
+		return ErrStoreBusy
+	}
+	s.queued++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.queued--
+		s.mu.Unlock()
+	}()
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			s.mu.Lock()
+			s.refund()
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if s.sem == nil {
+		return nil
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket and returns the time to wait until the
+// token is available.
+func (s *LimitStore) reserve() time.Duration {
+	if s.rate <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.rate
+	if s.tokens > s.burst {
+		s.tokens = s.burst
+	}
+	s.last = now
+	s.tokens--
+	if s.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-s.tokens / s.rate * float64(time.Second))
+}
+
+// refund returns a reserved token to the bucket.
+// Note: this method should only be called when the mutex is locked!
+func (s *LimitStore) refund() {
+	if s.rate > 0 {
+		s.tokens++
+	}
+}
+
+// trySlot takes a slot of concurrent retrievals without waiting, and returns
+// whether it succeeded.
+func (s *LimitStore) trySlot() bool {
+	if s.sem == nil {
+		return true
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release releases a slot of concurrent retrievals.
+func (s *LimitStore) release() {
+	if s.sem != nil {
+		<-s.sem
+	}
+}
+
+// StoreStats returns the LimitStore's current stats, added to those of the
+// wrapped store. LimitQueued holds the number of retrievals currently waiting
+// in the queue and LimitRejected the number of retrievals rejected.
+func (s *LimitStore) StoreStats() StoreStats {
+	return s.stats(false)
+}
+
+// ResetStoreStats resets the LimitStore's stats, along with those of the
+// wrapped store, and returns its stats as they were immediately before being
+// reset.
+func (s *LimitStore) ResetStoreStats() StoreStats {
+	return s.stats(true)
+}
+
+// stats returns the LimitStore's current stats, and resets them if reset is
+// true.
+func (s *LimitStore) stats(reset bool) StoreStats {
+	stats := storeStats(s.store, reset)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.LimitQueued += s.queued
+	stats.LimitRejected += s.rejected
+	if reset {
+		s.rejected = 0
+	}
+	return stats
+}
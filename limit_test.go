@@ -0,0 +1,208 @@
+package lru
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LimitStore", func() {
+
+	// blockingStore returns a store whose retrievals block until release is
+	// closed, and the number of retrievals in progress.
+	blockingStore := func(release chan struct{}) (Store, *int32) {
+		var active int32
+		return newStore(func(key []byte) ([]byte, error) {
+			atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			<-release
+			return []byte("value"), nil
+		}), &active
+	}
+
+	Context("Get", func() {
+
+		It("should limit the number of concurrent retrievals", func() {
+			release := make(chan struct{})
+			st, active := blockingStore(release)
+			s := NewLimitStore(st, 2)
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					v, err := s.Get([]byte("key"))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(v).Should(Equal([]byte("value")))
+				}()
+			}
+			Eventually(func() int64 {
+				return s.StoreStats().LimitQueued
+			}).Should(Equal(int64(3)))
+			Consistently(func() int32 {
+				return atomic.LoadInt32(active)
+			}, "20ms").Should(Equal(int32(2)))
+			close(release)
+			wg.Wait()
+			Ω(s.StoreStats().LimitQueued).Should(Equal(int64(0)))
+		})
+
+		It("should reject retrievals once the queue is full", func() {
+			release := make(chan struct{})
+			st, active := blockingStore(release)
+			s := NewLimitStore(st, 1)
+			s.SetMaxQueue(1)
+			done := make(chan struct{})
+			for i := 0; i < 2; i++ {
+				go func() {
+					s.Get([]byte("key"))
+					done <- struct{}{}
+				}()
+			}
+			Eventually(func() int64 {
+				return s.StoreStats().LimitQueued
+			}).Should(Equal(int64(1)))
+			Ω(atomic.LoadInt32(active)).Should(Equal(int32(1)))
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(Equal(ErrStoreBusy))
+			close(release)
+			<-done
+			<-done
+			stats := s.ResetStoreStats()
+			Ω(stats.LimitRejected).Should(Equal(int64(1)))
+			Ω(s.StoreStats().LimitRejected).Should(Equal(int64(0)))
+		})
+
+		It("should stop waiting once the context is done", func() {
+			release := make(chan struct{})
+			defer close(release)
+			st, _ := blockingStore(release)
+			s := NewLimitStore(st, 1)
+			go s.Get([]byte("key"))
+			Eventually(func() int {
+				return len(s.sem)
+			}).Should(Equal(1))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := s.GetContext(ctx, []byte("key"))
+			Ω(err).Should(Equal(context.DeadlineExceeded))
+			Ω(s.StoreStats().LimitQueued).Should(Equal(int64(0)))
+		})
+
+		It("should limit the rate of retrievals", func() {
+			st := newStore(func(key []byte) ([]byte, error) {
+				return []byte("value"), nil
+			})
+			s := NewLimitStore(st, 0)
+			s.SetRateLimit(100, 2)
+			start := time.Now()
+			for i := 0; i < 6; i++ {
+				_, err := s.Get([]byte("key"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			// 2 burst tokens, then 4 tokens at 10ms intervals
+			Ω(time.Since(start)).Should(BeNumerically(">=", 35*time.Millisecond))
+
+			s.SetMaxQueue(0)
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(Equal(ErrStoreBusy))
+			Ω(s.tokens).Should(BeNumerically(">", -1))
+		})
+	})
+
+	Context("optional interfaces", func() {
+
+		It("should provide the wrapped store's interfaces within the limits", func() {
+			root, err := ioutil.TempDir("", "limitstore")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(root)
+			s := NewLimitStore(NewDirStore(root), 1)
+			s.SetMaxQueue(0)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeTrue())
+			_, ok = streamStore(s)
+			Ω(ok).Should(BeTrue())
+			_, ok = rangeStore(s)
+			Ω(ok).Should(BeFalse())
+
+			l := NewLRU("", "", DefaultTwoQ(0), s)
+			err = l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.Set([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := ioutil.ReadFile(filepath.Join(root, "key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+
+			// a stream holds its slot until closed
+			rc, size, err := s.GetStream([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(size).Should(Equal(int64(5)))
+			_, err = s.Get([]byte("key"))
+			Ω(err).Should(Equal(ErrStoreBusy))
+			Ω(rc.Close()).Should(Succeed())
+			// closing the stream again doesn't release another slot
+			rc.Close()
+			l.Delete([]byte("key"))
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err = ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			Ω(r.Close()).Should(Succeed())
+			Eventually(func() error {
+				_, err := s.Get([]byte("key"))
+				return err
+			}).ShouldNot(HaveOccurred())
+		})
+
+		It("should reject writes into a wrapped store that isn't writable", func() {
+			st := newStore(func(key []byte) ([]byte, error) {
+				return []byte("value"), nil
+			})
+			s := NewLimitStore(NewRetryStore(st), 1)
+			s.SetMaxQueue(0)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeFalse())
+			// the write is rejected before waiting for the limits
+			Ω(s.acquire(context.Background())).Should(Succeed())
+			defer s.release()
+			err := s.Put([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			err = s.Delete([]byte("key"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			Ω(s.StoreStats().LimitRejected).Should(Equal(int64(0)))
+		})
+	})
+
+	Context("Stats", func() {
+
+		It("should include the rejections in the LRU's stats", func() {
+			st := newStore(func(key []byte) ([]byte, error) {
+				return []byte("value"), nil
+			})
+			ls := NewLimitStore(st, 0)
+			ls.SetRateLimit(0.001, 1)
+			ls.SetMaxQueue(0)
+			l := NewLRU("", "", DefaultTwoQ(0), ls)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			_, err = l.Get([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = l.Get([]byte("b"))
+			Ω(err).Should(Equal(ErrStoreBusy))
+			s := l.Stats()
+			Ω(s.Store.LimitRejected).Should(Equal(int64(1)))
+			Ω(s.Store.LimitQueued).Should(Equal(int64(0)))
+		})
+	})
+})
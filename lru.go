@@ -1,6 +1,8 @@
 package lru
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -24,11 +26,30 @@ type LRU struct {
 	db     *bolt.DB
 	dbPath string // database path
 	bName  []byte // LRU bucket name
+	eName  []byte // expiry bucket name
+	sName  []byte // algorithm state bucket name
+	rName  []byte // recency bucket name of earlier checkpoints
+	pName  []byte // stream staging bucket name
+	jName  []byte // write-back journal bucket name
+	vName  []byte // write-back journal chunked values bucket name
 
 	// remote store
 	store  Store
+	neg    *negCache       // cache of keys not found in the remote store
 	muReqs sync.Mutex      // mutex protecting the reqs map
 	reqs   map[string]*req // map of current remote store requests
+	nextID uint64          // ID of the next stream, protected by muReqs
+
+	// remote store writes
+	wmode    WriteMode     // mode of writes into the remote store
+	flushSig chan struct{} // signalled when the journal has new entries
+	muFlush  sync.Mutex    // mutex serializing flushes of the journal
+	maxFlush int           // max failed flushes of a write, 0 = unlimited
+
+	// keys with remote store writes queued in the journal, mapped to the
+	// sequence number of their latest write
+	muPending sync.Mutex
+	pending   map[string]uint64
 
 	// mutex protecting everything below
 	mu sync.Mutex
@@ -36,22 +57,87 @@ type LRU struct {
 	// internal LRU algorithm
 	lru Algorithm
 
+	// item expiration
+	ttl     time.Duration        // default time-to-live of new items
+	reapInt time.Duration        // interval between purges of expired items
+	grace   time.Duration        // time expired items may still be served
+	expires map[string]time.Time // expiration times of items with a TTL
+
+	// chunked storage
+	chunkSize int // size of the chunks of large values in the database
+
+	// algorithm state checkpoints
+	cpInt time.Duration // interval between checkpoints of the algorithm
+
+	// background goroutines
+	quit chan struct{}  // closed to stop all background goroutines
+	bg   sync.WaitGroup // wait group of all background goroutines
+
 	// cache stats
-	sTime    time.Time // starting time
-	hits     int64     // # of cache hits
-	misses   int64     // # of cache misses
-	bget     int64     // # of bytes retrieved
-	puts     int64     // # of puts completed
-	bput     int64     // # of bytes written
-	evicted  int64     // # of items evicted
-	bevicted int64     // # of bytes evicted
+	sTime     time.Time // starting time
+	hits      int64     // # of cache hits
+	staleHits int64     // # of cache hits serving expired values
+	negHits   int64     // # of misses served from the negative cache
+	misses    int64     // # of cache misses
+	bget      int64     // # of bytes retrieved
+	puts      int64     // # of puts completed
+	bput      int64     // # of bytes written
+	evicted   int64     // # of items evicted
+	bevicted  int64     // # of bytes evicted
+	deleted   int64     // # of items deleted
+	bdeleted  int64     // # of bytes deleted
+	expired   int64     // # of items expired
+	jfails    int64     // # of failed flushes of the oldest queued write
+	jfailSeq  uint64    // sequence number of the write jfails counts
+	jdropped  int64     // # of queued writes dropped without being flushed
 }
 
 // req represents a remote store request.
 type req struct {
-	wg    sync.WaitGroup
+	done  chan struct{} // closed once value and err are set
 	value []byte
 	err   error
+	ttl   time.Duration // time-to-live of the value once cached
+
+	ctx     context.Context    // context of the remote store request
+	stop    context.CancelFunc // cancels the remote store request
+	waiters int                // # of callers waiting, protected by muReqs
+	s       *stream            // stream of the value from a StreamStore
+	hints   storeHints         // hints exchanged with the remote store
+
+	mu        sync.Mutex // mutex protecting the write into the cache
+	cancelled bool       // whether the value should no longer be cached
+}
+
+// newReq returns a new remote store request whose value is cached with the
+// provided TTL.
+func newReq(ttl time.Duration) *req {
+	r := &req{done: make(chan struct{}), ttl: ttl}
+	ctx := context.WithValue(context.Background(), storeHintsKey{}, &r.hints)
+	r.ctx, r.stop = context.WithCancel(ctx)
+	return r
+}
+
+// newDoneReq returns a new completed request with the provided value and TTL.
+func newDoneReq(val []byte, ttl time.Duration) *req {
+	r := &req{done: make(chan struct{}), value: val, ttl: ttl}
+	close(r.done)
+	return r
+}
+
+// complete sets the request's value and error and notifies all waiters.
+func (r *req) complete(val []byte, err error) {
+	r.value, r.err = val, err
+	r.stop()
+	close(r.done)
+}
+
+// cancel prevents the request's value from being written into the cache. If
+// the value is currently being written, cancel waits for the write to finish.
+func (r *req) cancel() {
+	r.mu.Lock()
+	r.cancelled = true
+	r.mu.Unlock()
 }
 
 // NewLRU returns a new LRU object with the provided database path, bucket name,
@@ -77,12 +163,24 @@ func NewLRU(dbPath, bName string, alg Algorithm, store Store) *LRU {
 	}
 	// initialize LRU
 	return &LRU{
-		dbPath: dbPath,
-		bName:  []byte(bName),
-		store:  store,
-		reqs:   make(map[string]*req),
-		lru:    alg,
-		sTime:  time.Now().UTC(),
+		dbPath:  dbPath,
+		bName:   []byte(bName),
+		eName:   []byte(bName + "_expiry"),
+		sName:   []byte(bName + "_state"),
+		rName:   []byte(bName + "_recency"),
+		pName:   []byte(bName + "_stream"),
+		jName:   []byte(bName + "_journal"),
+		vName:   []byte(bName + "_journal_values"),
+		store:   store,
+		reqs:    make(map[string]*req),
+		lru:     alg,
+		reapInt: defaultReapInterval,
+		cpInt:   defaultCheckpointInterval,
+		expires: make(map[string]time.Time),
+		sTime:   time.Now().UTC(),
+
+		flushSig: make(chan struct{}, 1),
+		pending:  make(map[string]uint64),
 	}
 }
 
@@ -93,32 +191,122 @@ func (l *LRU) Open() error {
 	if err := l.store.Open(); err != nil {
 		return err
 	}
-	return l.openBoltDB()
+	if err := l.openBoltDB(); err != nil {
+		return err
+	}
+	l.quit = make(chan struct{})
+	if l.reapInt > 0 {
+		l.every(l.reapInt, l.reap)
+	}
+	if l.cpInt > 0 {
+		l.every(l.cpInt, func() {
+			l.saveState()
+		})
+	}
+	if _, ok := writableStore(l.store); ok {
+		l.flushInBackground()
+	}
+	return nil
 }
 
-// Close closes the LRU's remote store and the connection to the local bolt
-// database and returns any error encountered.
+// Close drains the write-back journal into the remote store, closes the LRU's
+// remote store and the connection to the local bolt database and returns any
+// error encountered. Writes remaining in the journal after a failure to drain
+// it are retried once the LRU is opened again.
 func (l *LRU) Close() error {
+	ferr := l.stop()
 	if err := l.store.Close(); err != nil {
 		l.close()
 		return err
 	}
-	return l.close()
+	if err := l.close(); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// stop stops all background goroutines and then flushes the write-back journal,
+// returning any error encountered while flushing.
+func (l *LRU) stop() error {
+	if l.quit == nil {
+		return nil
+	}
+	close(l.quit)
+	l.bg.Wait()
+	l.quit = nil
+	return l.flushJournal()
 }
 
-// close closes the underlying bolt database and zeros the LRU. An LRU cannot
-// be used after calling this method.
+// close checkpoints the state of the LRU's algorithm, closes the underlying
+// bolt database and zeros the LRU. An LRU cannot be used after calling this
+// method.
 func (l *LRU) close() error {
+	err := l.saveState()
 	l.mu.Lock()
 	l.lru.Empty()
+	l.expires = make(map[string]time.Time)
 	l.mu.Unlock()
-	return l.db.Close()
+	if cerr := l.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// every calls the provided function in a background goroutine at the provided
+// interval until the LRU is closed.
+func (l *LRU) every(interval time.Duration, fn func()) {
+	quit := l.quit
+	l.bg.Add(1)
+	go func() {
+		defer l.bg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-t.C:
+				fn()
+			}
+		}
+	}()
 }
 
 // Get attempts to retrieve the value for the provided key. An error is returned
 // if either no value exists or an error occurs while retrieving the value from
 // the remote store. Byte slices returned by this method should not be modified.
 func (l *LRU) Get(key []byte) ([]byte, error) {
+	return l.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but stops waiting for the remote store once the
+// provided context is done, returning the context's error. The remote store
+// request itself continues on behalf of any other callers waiting for the same
+// key, and is only cancelled once all of them have stopped waiting. If the
+// LRU's store is a ContextStore, it receives a context that is cancelled at
+// that time.
+func (l *LRU) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	return l.get(ctx, key, l.fetchFromStore)
+}
+
+// GetOrLoad is like Get, but calls the provided loader to retrieve a value
+// missing from the cache instead of the LRU's remote store. The loader is only
+// called if no other request for the same key is currently in progress, in
+// which case that request's result is returned instead. If the loader panics,
+// the panic is recovered and an error is returned. Upon success, the value is
+// written into the cache asynchronously.
+func (l *LRU) GetOrLoad(key []byte, loader func([]byte) ([]byte, error)) ([]byte, error) {
+	if loader == nil {
+		return l.Get(key)
+	}
+	return l.get(context.Background(), key, func(_ context.Context, key []byte) ([]byte, error) {
+		return loader(key)
+	})
+}
+
+// get attempts to retrieve the value for the provided key from the local cache,
+// falling back to the provided fetch function.
+func (l *LRU) get(ctx context.Context, key []byte, fetch fetchFunc) ([]byte, error) {
 	if len(key) == 0 {
 		return nil, ErrNoKey
 	}
@@ -130,7 +318,7 @@ func (l *LRU) Get(key []byte) ([]byte, error) {
 		l.hitToMiss(size)
 	}
 	// retrieve from the remote store
-	return l.getFromStore(key)
+	return l.load(ctx, key, fetch)
 }
 
 // GetBuffer attempts to retrieve the value for the provided key, returning
@@ -146,6 +334,12 @@ func (l *LRU) Get(key []byte) ([]byte, error) {
 // Buffer's Bytes and WriteTo methods cannot be called concurrently with its
 // Close method.
 func (l *LRU) GetBuffer(key []byte) (*Buffer, error) {
+	return l.GetBufferContext(context.Background(), key)
+}
+
+// GetBufferContext is like GetBuffer, but stops waiting for the remote store
+// once the provided context is done, in the same manner as GetContext.
+func (l *LRU) GetBufferContext(ctx context.Context, key []byte) (*Buffer, error) {
 	if len(key) == 0 {
 		return nil, ErrNoKey
 	}
@@ -157,34 +351,312 @@ func (l *LRU) GetBuffer(key []byte) (*Buffer, error) {
 		l.hitToMiss(size)
 	}
 	// retrieve from the remote store
-	v, err := l.getFromStore(key)
+	v, err := l.load(ctx, key, l.fetchFromStore)
 	if err != nil {
 		return nil, err
 	}
 	return newBufferFromData(v), nil
 }
 
+// GetReader attempts to retrieve the value for the provided key, returning a
+// Reader. An error is returned if either no value exists or an error occurs
+// while retrieving the value from the remote store. After finishing with the
+// returned Reader, its Close method should be called.
+//
+// The advantage to using this method over Get and GetBuffer is that a value in
+// the local cache is read directly from the bolt database's memory map, without
+// being copied. To do so, the Reader holds a bolt read transaction open until it
+// is closed. Readers should be closed promptly, as an open read transaction
+// prevents the bolt database from being resized and causes Close to block.
+//
+// If the value is missing and the LRU's store is a StreamStore, the returned
+// Reader streams the value as it is retrieved from the remote store, sharing
+// the stream with all other callers requesting the same key. The stream is
+// staged in the bolt database as it is received and written into the cache
+// once complete.
+func (l *LRU) GetReader(key []byte) (*Reader, error) {
+	return l.GetReaderContext(context.Background(), key)
+}
+
+// GetReaderContext is like GetReader, but stops waiting for the remote store
+// once the provided context is done, in the same manner as GetContext.
+func (l *LRU) GetReaderContext(ctx context.Context, key []byte) (*Reader, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	// attempt to get a reader from local cache
+	if size := l.hit(key); size >= 0 {
+		if r := l.getReaderFromBolt(key); r != nil {
+			return r, nil
+		}
+		l.hitToMiss(size)
+	}
+	// stream from a StreamStore or retrieve from the remote store, unless a
+	// write of the key is queued in the journal
+	if ss, ok := streamStore(l.store); ok && !l.isPending(key) {
+		return l.loadStream(ctx, key, ss)
+	}
+	v, err := l.load(ctx, key, l.fetchFromStore)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(nil, v), nil
+}
+
+// Peek returns the value for the provided key if it exists in the local cache,
+// or nil otherwise. Unlike Get, Peek never contacts the remote store and
+// doesn't affect the cache's stats or the recency of the item. Byte slices
+// returned by this method should not be modified.
+func (l *LRU) Peek(key []byte) []byte {
+	if !l.Contains(key) {
+		return nil
+	}
+	return l.getFromBolt(key)
+}
+
+// Contains returns true if a value for the provided key exists in the local
+// cache. Like Peek, Contains doesn't affect the cache's stats or the recency of
+// the item.
+func (l *LRU) Contains(key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isExpired(key, now.Add(-l.grace)) {
+		return false
+	}
+	return l.lru.Peek(key) >= 0
+}
+
+// Put inserts the provided key and value into the cache with the LRU's default
+// TTL, replacing any existing value. Any remote store request currently in
+// progress for the same key will not overwrite the provided value once it
+// completes. The provided value may be modified after Put returns.
+func (l *LRU) Put(key, val []byte) error {
+	return l.PutWithTTL(key, val, l.defaultTTL())
+}
+
+// PutWithTTL inserts the provided key and value into the cache, replacing any
+// existing value. The value expires once the provided TTL has elapsed, or never
+// if the TTL is not positive. Any remote store request currently in progress
+// for the same key will not overwrite the provided value once it completes. The
+// provided value may be modified after PutWithTTL returns.
+func (l *LRU) PutWithTTL(key, val []byte, ttl time.Duration) error {
+	return l.putWithTTL(key, val, ttl, false)
+}
+
+// putWithTTL inserts the provided key and value into the cache as PutWithTTL
+// does. If journal is true, the remote store write of the value is queued in
+// the journal within the same transaction as the cache write.
+func (l *LRU) putWithTTL(key, val []byte, ttl time.Duration, journal bool) error {
+	if len(key) == 0 {
+		return ErrNoKey
+	}
+	if val == nil {
+		return ErrNoValue
+	}
+	v := make([]byte, len(val))
+	copy(v, val)
+	k := make([]byte, len(key))
+	copy(k, key)
+
+	var j *journalEntry
+	if journal {
+		j = newJournalEntry(journalPut, k, v)
+	}
+
+	// register the put as the latest request for the key, so that
+	// concurrent retrievals receive the new value and any request in
+	// progress is prevented from caching its value. The put holds its
+	// request's lock until written, so that a later write of the key
+	// cancelling it waits for it, and their journal entries are queued in
+	// the order in which they were registered.
+	r := newDoneReq(v, ttl)
+	r.mu.Lock()
+	l.muReqs.Lock()
+	prev := l.reqs[string(k)]
+	l.reqs[string(k)] = r
+	l.muReqs.Unlock()
+	if prev != nil {
+		prev.cancel()
+	}
+	l.removeNegative(k)
+	err := l.putTTL(k, v, ttl, j)
+	r.mu.Unlock()
+	l.deleteReq(k, r)
+	return err
+}
+
+// PutBuffer inserts the provided key and the contents of the provided Buffer
+// into the cache, replacing any existing value. The Buffer is not closed and
+// may be closed by the caller once PutBuffer returns.
+func (l *LRU) PutBuffer(key []byte, buf *Buffer) error {
+	if buf == nil || buf.closed {
+		return ErrNoValue
+	}
+	return l.Put(key, buf.Bytes())
+}
+
+// Delete removes the values with the provided keys from the cache. Any remote
+// store request currently in progress for one of the keys will not write its
+// value into the cache once it completes.
+func (l *LRU) Delete(keys ...[]byte) error {
+	return l.delete(keys, nil)
+}
+
+// delete removes the values with the provided keys from the cache as Delete
+// does. If the provided journal entry isn't nil, it is queued in the journal
+// within the same transaction as the deletion from the bolt database.
+func (l *LRU) delete(keys [][]byte, j *journalEntry) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// cancel any requests in progress so that they don't re-insert the
+	// deleted values. A queued deletion registers a completed "not found"
+	// request for its keys until its journal entry is committed, so that
+	// retrievals in the meantime don't cache the remote store's value, and
+	// holds its lock so that later writes of the keys are queued after it.
+	var r *req
+	if j != nil {
+		r = newDoneReq(nil, 0)
+		r.err = ErrNotFound
+		r.mu.Lock()
+	}
+	l.muReqs.Lock()
+	var cancelled []*req
+	for _, key := range keys {
+		if prev, ok := l.reqs[string(key)]; ok {
+			delete(l.reqs, string(key))
+			cancelled = append(cancelled, prev)
+		}
+		if r != nil {
+			l.reqs[string(key)] = r
+		}
+	}
+	l.muReqs.Unlock()
+	for _, prev := range cancelled {
+		prev.cancel()
+	}
+	l.removeNegative(keys...)
+	l.removeItems(keys)
+	err := l.deleteFromBolt(keys, j)
+	if r != nil {
+		r.mu.Unlock()
+		for _, key := range keys {
+			l.deleteReq(key, r)
+		}
+	}
+	return err
+}
+
+// DeletePrefix removes all values with keys beginning with the provided prefix
+// from the cache. Any remote store requests currently in progress for matching
+// keys will not write their values into the cache once they complete.
+func (l *LRU) DeletePrefix(prefix []byte) error {
+	if len(prefix) == 0 {
+		return ErrNoKey
+	}
+	return l.deleteMatching(prefix, func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
+}
+
+// DeleteRange removes all values with keys greater than or equal to start and
+// less than end from the cache. If end is nil, all keys greater than or equal
+// to start are removed. Any remote store requests currently in progress for
+// matching keys will not write their values into the cache once they complete.
+func (l *LRU) DeleteRange(start, end []byte) error {
+	return l.deleteMatching(start, func(key []byte) bool {
+		return end == nil || bytes.Compare(key, end) < 0
+	})
+}
+
+// deleteMatching cancels all requests for keys that are greater than or equal
+// to seek and satisfy the provided match function, then removes the matching
+// items from the LRU and bolt database. The match function must return false
+// for all keys following the last matching key.
+func (l *LRU) deleteMatching(seek []byte, match func([]byte) bool) error {
+	l.muReqs.Lock()
+	var cancelled []*req
+	for key, r := range l.reqs {
+		if k := []byte(key); bytes.Compare(k, seek) >= 0 && match(k) {
+			delete(l.reqs, key)
+			cancelled = append(cancelled, r)
+		}
+	}
+	l.muReqs.Unlock()
+	for _, r := range cancelled {
+		r.cancel()
+	}
+	if l.neg != nil {
+		l.neg.removeMatching(seek, match)
+	}
+	keys, err := l.deleteMatchingFromBolt(seek, match)
+	l.removeItems(keys)
+	return err
+}
+
+// removeItems removes the provided keys from the LRU and records the number
+// of items and bytes that were deleted.
+func (l *LRU) removeItems(keys [][]byte) {
+	l.mu.Lock()
+	for _, key := range keys {
+		if size := l.lru.Remove(key); size >= 0 {
+			l.deleted++
+			l.bdeleted += size
+		}
+		delete(l.expires, string(key))
+	}
+	l.mu.Unlock()
+}
+
 // Empty completely empties the cache and underlying bolt database.
 func (l *LRU) Empty() error {
 	l.mu.Lock()
 	l.lru.Empty()
+	l.expires = make(map[string]time.Time)
 	l.mu.Unlock()
+	if l.neg != nil {
+		l.neg.empty()
+	}
 	return l.emptyBolt()
 }
 
 // hit registers a 'hit' for the provided key in the LRU and returns the size of
-// the value in bytes if it exists. If no key was found, hit registers a 'miss'
-// and returns -1.
+// the value in bytes if it exists. If no key was found or the item has expired,
+// hit registers a 'miss' and returns -1. If the item has expired but is within
+// the stale grace period, its size is returned and the value is refreshed from
+// the remote store in the background.
 func (l *LRU) hit(key []byte) int64 {
+	now := time.Now()
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	if size := l.lru.Get(key); size >= 0 {
-		l.hits++
-		l.bget += size
-		return size
+	var stale bool
+	if l.isExpired(key, now) {
+		if l.isExpired(key, now.Add(-l.grace)) {
+			l.misses++
+			l.mu.Unlock()
+			return -1
+		}
+		stale = true
 	}
-	l.misses++
-	return -1
+	size := l.lru.Get(key)
+	if size < 0 {
+		l.misses++
+		l.mu.Unlock()
+		return -1
+	}
+	l.hits++
+	l.bget += size
+	if stale {
+		l.staleHits++
+	}
+	l.mu.Unlock()
+	if stale {
+		l.refresh(key)
+	}
+	return size
 }
 
 // hitToMiss registers that a retrieval attempt previously considered as a
@@ -203,45 +675,133 @@ func (l *LRU) hitToMiss(size int64) {
 // this method will wait for that request to complete and return the resulting
 // value and error.
 func (l *LRU) getFromStore(key []byte) ([]byte, error) {
+	return l.load(context.Background(), key, l.fetchFromStore)
+}
+
+// load attempts to retrieve the value with the provided key using the provided
+// fetch function. If another goroutine has already requested the same value,
+// this method will wait for that request to complete instead. It stops waiting
+// for the request once the provided context is done. If no other goroutines
+// are waiting for the request at that time, the request is cancelled.
+func (l *LRU) load(ctx context.Context, key []byte, fetch fetchFunc) ([]byte, error) {
 
 	// register request
+	ttl := l.defaultTTL()
+	l.muReqs.Lock()
+	r, ok := l.reqs[string(key)]
+	if !ok {
+		k := make([]byte, len(key))
+		copy(k, key)
+		r = newReq(ttl)
+		r.hints.stale = l.staleValue(k)
+		l.reqs[string(k)] = r
+		go l.fetchReq(k, r, fetch)
+	}
+	r.waiters++
+	if r.s != nil {
+		// the request is streamed, hold on to its staged chunks
+		r.s.ref()
+		defer r.s.unref()
+	}
+	l.muReqs.Unlock()
+
+	// wait for the request to complete or the context to be done
+	if err := l.wait(ctx, key, r, r.done); err != nil {
+		return nil, err
+	}
+	return l.reqValue(r)
+}
+
+// wait waits for the provided channel of the provided registered request to be
+// closed, or for the provided context to be done. In the latter case, the
+// caller stops waiting for the request and the context's error is returned.
+func (l *LRU) wait(ctx context.Context, key []byte, r *req, ready <-chan struct{}) error {
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+	l.abandon(key, r)
+	return ctx.Err()
+}
+
+// abandon registers that a caller is no longer waiting for the provided
+// request. Once nobody is waiting for the request anymore, it is stopped and
+// deleted from the "reqs" map, unless it has already completed.
+func (l *LRU) abandon(key []byte, r *req) {
 	l.muReqs.Lock()
-	if r, ok := l.reqs[string(key)]; ok {
-		// a request for this key is currently in progress
+	r.waiters--
+	if r.waiters == 0 {
+		select {
+		case <-r.done:
+		default:
+			// nobody is waiting for the request anymore
+			r.stop()
+			if l.reqs[string(key)] == r {
+				delete(l.reqs, string(key))
+			}
+		}
+	}
+	l.muReqs.Unlock()
+}
+
+// refresh retrieves the value with the provided key from the remote store in
+// the background and writes it into the cache, unless a request for the same
+// key is already in progress.
+func (l *LRU) refresh(key []byte) {
+	ttl := l.defaultTTL()
+	l.muReqs.Lock()
+	if _, ok := l.reqs[string(key)]; ok {
 		l.muReqs.Unlock()
-		r.wg.Wait()
-		return r.value, r.err
+		return
 	}
-	r := &req{}
-	r.wg.Add(1)
-	l.reqs[string(key)] = r
+	k := make([]byte, len(key))
+	copy(k, key)
+	r := newReq(ttl)
+	r.hints.stale = l.staleValue(k)
+	// the refresh is never abandoned by its waiter
+	r.waiters = 1
+	l.reqs[string(k)] = r
 	l.muReqs.Unlock()
 
-	// obtain the result from the remote store
-	r.value, r.err = l.getResFromStore(key)
-	r.wg.Done()
+	go l.fetchReq(k, r, l.fetchFromStore)
+}
 
-	// if an error occurred, delete the request and return the error.
-	if r.err != nil {
-		l.deleteReq(key)
-		return nil, r.err
+// staleValue returns a function reading the value with the provided key that
+// is still in the bolt database, if any, such as an expired value. It is
+// provided to the remote store as the stale value being retrieved again.
+func (l *LRU) staleValue(key []byte) func() []byte {
+	return func() []byte {
+		return l.getFromBolt(key)
 	}
+}
 
-	// in a new goroutine, write the received value to the database + LRU
-	// and then delete the request from the "reqs" map.
-	go func() {
-		l.put(key, r.value)
-		l.deleteReq(key)
-	}()
+// fetchReq obtains the result of the provided registered request using the
+// provided fetch function and, if successful, writes the value into the cache.
+// The request is deleted from the "reqs" map once complete.
+func (l *LRU) fetchReq(key []byte, r *req, fetch fetchFunc) {
+	// obtain the result from the remote store, along with any TTL it set
+	val, err := l.getRes(r.ctx, key, fetch)
+	if ttl, ok := r.hints.valueTTL(); ok {
+		r.ttl = ttl
+	}
+	r.complete(val, err)
 
-	return r.value, nil
+	// write the received value to the database + LRU
+	if r.err == nil {
+		l.putReq(key, r)
+	}
+	l.deleteReq(key, r)
 }
 
-// getResFromStore attempts to retrieve the value from the remote store
-// corresponding to the provided key. If the PostStoreFn is non-nil, it is
-// called. If either the store's Get method or PostStoreFn panic, the panic is
-// recovered and an error is returned to the caller.
-func (l *LRU) getResFromStore(key []byte) (val []byte, err error) {
+// fetchFunc retrieves the value corresponding to the provided key from a
+// remote origin.
+type fetchFunc func(context.Context, []byte) ([]byte, error)
+
+// getRes attempts to retrieve the value corresponding to the provided key
+// using the provided fetch function. If the fetch function panics, the panic
+// is recovered and an error is returned to the caller.
+func (l *LRU) getRes(ctx context.Context, key []byte, fetch fetchFunc) (val []byte, err error) {
 	// recover from a panic by returning an error
 	defer func() {
 		if r := recover(); r != nil {
@@ -249,9 +809,9 @@ func (l *LRU) getResFromStore(key []byte) (val []byte, err error) {
 			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
-	// obtain the results from the remote store ensure that exactly one of
-	// 'val' or 'err' is nil
-	val, err = l.store.Get(key)
+	// obtain the results and ensure that exactly one of 'val' or 'err' is
+	// nil
+	val, err = fetch(ctx, key)
 	if err != nil {
 		val = nil
 	} else if val == nil {
@@ -260,38 +820,88 @@ func (l *LRU) getResFromStore(key []byte) (val []byte, err error) {
 	return
 }
 
-// deleteReq safely deletes the request from the "reqs" map with the provided
-// key.
-func (l *LRU) deleteReq(key []byte) {
+// fetchFromStore retrieves the value corresponding to the provided key from the
+// remote store, unless a write of the key is queued in the journal or the key
+// is in the negative cache.
+func (l *LRU) fetchFromStore(ctx context.Context, key []byte) ([]byte, error) {
+	// return the value of a queued write the remote store doesn't have yet
+	if e := l.pendingWrite(key); e != nil {
+		return e.result()
+	}
+	// return the cached error if the store recently reported that no value
+	// exists
+	if err := l.getNegative(key); err != nil {
+		return nil, err
+	}
+	val, err := storeGet(ctx, l.store, key)
+	if err == nil && val == nil {
+		err = ErrNoValue
+	}
+	l.putNegative(key, err)
+	return val, err
+}
+
+// deleteReq safely deletes the provided request from the "reqs" map with the
+// provided key. If the request has since been replaced by another, the map is
+// left unchanged.
+func (l *LRU) deleteReq(key []byte, r *req) {
 	l.muReqs.Lock()
-	delete(l.reqs, string(key))
+	if l.reqs[string(key)] == r {
+		delete(l.reqs, string(key))
+	}
 	l.muReqs.Unlock()
 }
 
-// put adds the provided key and value to the local cache and LRU. If the cache
-// now exceeds its capacity, the least recently used item(s) will be evicted.
+// putReq writes the provided request's value into the cache with the provided
+// key, unless the request has been cancelled.
+func (l *LRU) putReq(key []byte, r *req) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancelled {
+		return nil
+	}
+	return l.putTTL(key, r.value, r.ttl, nil)
+}
+
+// put adds the provided key and value to the local cache and LRU with the
+// default TTL. If the cache now exceeds its capacity, the least recently used
+// item(s) will be evicted.
 func (l *LRU) put(key, val []byte) error {
+	return l.putTTL(key, val, l.defaultTTL(), nil)
+}
+
+// putTTL adds the provided key and value to the local cache and LRU, expiring
+// after the provided TTL if it is positive. If the cache now exceeds its
+// capacity, the least recently used item(s) will be evicted. The provided
+// journal entry, if not nil, is queued along with the value.
+func (l *LRU) putTTL(key, val []byte, ttl time.Duration, j *journalEntry) error {
+	exp := expiryFromTTL(ttl)
 	// add to boltdb store
-	if err := l.putIntoBolt(key, val); err != nil {
+	if err := l.putIntoBolt(key, val, exp, j); err != nil {
 		return err
 	}
 	// add to LRU
-	l.addItem(key, int64(len(val)))
+	l.addItem(key, int64(len(val)), exp)
 	return nil
 }
 
-// addItem adds the provided key and size to the LRU. If there are any items
-// that have been pruned, they will be deleted from the bolt database.
-func (l *LRU) addItem(key []byte, size int64) {
+// addItem adds the provided key, size and expiration time to the LRU. If there
+// are any items that have been pruned, they will be deleted from the bolt
+// database.
+func (l *LRU) addItem(key []byte, size int64, exp time.Time) {
 	l.mu.Lock()
 	evicted, bytes := l.lru.PutAndEvict(key, size)
 	l.puts++
 	l.bput += size
+	l.setExpiry(key, exp)
 	if len(evicted) > 0 {
 		l.evicted += int64(len(evicted))
 		l.bevicted += bytes
+		for _, k := range evicted {
+			delete(l.expires, string(k))
+		}
 		l.mu.Unlock()
-		l.deleteFromBolt(evicted)
+		l.deleteFromBolt(evicted, nil)
 		return
 	}
 	l.mu.Unlock()
@@ -1,6 +1,7 @@
 package lru
 
 import (
+	"context"
 	"io"
 	"testing"
 
@@ -60,3 +61,24 @@ func (s *testStore) Close() error {
 func (s *testStore) Get(key []byte) ([]byte, error) {
 	return s.get(key)
 }
+
+func newContextStore(get func(context.Context, []byte) ([]byte, error)) Store {
+	return &testContextStore{get}
+}
+
+type testContextStore struct {
+	get func(context.Context, []byte) ([]byte, error)
+}
+
+func (s *testContextStore) Open() error {
+	return nil
+}
+func (s *testContextStore) Close() error {
+	return nil
+}
+func (s *testContextStore) Get(key []byte) ([]byte, error) {
+	return s.get(context.Background(), key)
+}
+func (s *testContextStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	return s.get(ctx, key)
+}
@@ -1,7 +1,11 @@
 package lru
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	"io/ioutil"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -140,6 +144,175 @@ var _ = Describe("LRU", func() {
 		})
 	})
 
+	Context("GetContext", func() {
+
+		It("should return the context's error once the context is done", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			release := make(chan struct{})
+			defer close(release)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				<-release
+				return []byte("value"), nil
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+			defer cancel()
+			v, err := l.GetContext(ctx, []byte("key"))
+			Ω(err).Should(MatchError(context.DeadlineExceeded))
+			Ω(v).Should(BeNil())
+		})
+
+		It("should not cancel the remote store request while other callers are waiting", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			started := make(chan struct{})
+			release := make(chan struct{})
+			l.store = newContextStore(func(ctx context.Context, key []byte) ([]byte, error) {
+				close(started)
+				select {
+				case <-release:
+					return []byte("value"), nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				v, err := l.Get([]byte("key"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(v)).Should(Equal("value"))
+				close(done)
+			}()
+			<-started
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := l.GetContext(ctx, []byte("key"))
+			Ω(err).Should(MatchError(context.Canceled))
+			close(release)
+			<-done
+		})
+
+		It("should cancel the remote store request once all callers stop waiting", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			stopped := make(chan error, 1)
+			l.store = newContextStore(func(ctx context.Context, key []byte) ([]byte, error) {
+				<-ctx.Done()
+				stopped <- ctx.Err()
+				return nil, ctx.Err()
+			})
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+					defer cancel()
+					_, err := l.GetContext(ctx, []byte("key"))
+					Ω(err).Should(MatchError(context.DeadlineExceeded))
+				}()
+			}
+			wg.Wait()
+			Eventually(stopped).Should(Receive(MatchError(context.Canceled)))
+			l.muReqs.Lock()
+			defer l.muReqs.Unlock()
+			Ω(l.reqs).Should(HaveLen(0))
+		})
+	})
+
+	Context("GetBufferContext", func() {
+
+		It("should return the context's error once the context is done", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			release := make(chan struct{})
+			defer close(release)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				<-release
+				return []byte("value"), nil
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			buf, err := l.GetBufferContext(ctx, []byte("key"))
+			Ω(err).Should(MatchError(context.Canceled))
+			Ω(buf).Should(BeNil())
+		})
+	})
+
+	Context("GetOrLoad", func() {
+
+		It("should return a value from the local bolt cache without calling the loader", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := l.GetOrLoad([]byte("key"), func(key []byte) ([]byte, error) {
+				Fail("loader called")
+				return nil, nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("value"))
+		})
+
+		It("should return and cache a value from the loader instead of the remote store", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &errStore{}
+			v, err := l.GetOrLoad([]byte("key"), func(key []byte) ([]byte, error) {
+				Ω(string(key)).Should(Equal("key"))
+				return []byte("loaded"), nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("loaded"))
+			Eventually(func() []byte {
+				return l.getFromBolt([]byte("key"))
+			}, 100*time.Millisecond, time.Millisecond).ShouldNot(BeNil())
+		})
+
+		It("should use the remote store when no loader is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			_, err := l.GetOrLoad([]byte("key"), nil)
+			Ω(err).Should(MatchError(errNoStore))
+		})
+
+		It("shouldn't call the loader multiple times for the same key", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			var reqs int64
+			loader := func(key []byte) ([]byte, error) {
+				atomic.AddInt64(&reqs, 1)
+				time.Sleep(time.Millisecond)
+				return []byte("value"), nil
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					v, err := l.GetOrLoad([]byte("key"), loader)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(v)).Should(Equal("value"))
+				}()
+			}
+			wg.Wait()
+			Ω(reqs).Should(Equal(int64(1)))
+		})
+
+		It("should recover from a panic in the loader and return an error", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			v, err := l.GetOrLoad([]byte("key"), func(key []byte) ([]byte, error) {
+				panic("error message")
+			})
+			Ω(err).Should(MatchError("panic: error message"))
+			Ω(v).Should(BeNil())
+		})
+	})
+
 	Context("GetBuffer", func() {
 
 		It("should return an error when no key is provided", func() {
@@ -203,6 +376,188 @@ var _ = Describe("LRU", func() {
 		})
 	})
 
+	Context("GetReader", func() {
+
+		It("should return an error when no key is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			r, err := l.GetReader(nil)
+			Ω(r).Should(BeNil())
+			Ω(err).Should(MatchError(ErrNoKey))
+		})
+
+		It("should return a reader holding a transaction for a value in the local bolt cache", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			l.store = &errStore{}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.tx).ShouldNot(BeNil())
+			Ω(l.db.Stats().OpenTxN).Should(Equal(1))
+			var buf bytes.Buffer
+			n, err := io.Copy(&buf, r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(n).Should(Equal(int64(5)))
+			Ω(buf.String()).Should(Equal("value"))
+			err = r.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.db.Stats().OpenTxN).Should(Equal(0))
+			stats := l.Stats()
+			Ω(stats.Hits).Should(Equal(int64(1)))
+		})
+
+		It("should return a reader for a value from the remote store", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				return []byte("value"), nil
+			})
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r.Close()
+			Ω(r.tx).Should(BeNil())
+			v, err := ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("value"))
+		})
+
+		It("should return an error from the remote store", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &errStore{}
+			r, err := l.GetReader([]byte("key"))
+			Ω(r).Should(BeNil())
+			Ω(err).Should(MatchError("test error"))
+		})
+	})
+
+	Context("Peek", func() {
+
+		It("should return nil when the key isn't cached", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &errStore{}
+			Ω(l.Peek([]byte("key"))).Should(BeNil())
+			Ω(l.Peek(nil)).Should(BeNil())
+			Ω(l.misses).Should(Equal(int64(0)))
+		})
+
+		It("should return a cached value without affecting stats or recency", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v := l.Peek([]byte("key"))
+			Ω(string(v)).Should(Equal("value"))
+			Ω(l.hits).Should(Equal(int64(0)))
+			Ω(l.bget).Should(Equal(int64(0)))
+			Ω(isFront(twoQWarm, l.lru.(*TwoQ), "key")).Should(BeTrue())
+			Ω(l.lru.(*TwoQ).lruHot.list.Len()).Should(Equal(0))
+		})
+	})
+
+	Context("Contains", func() {
+
+		It("should report whether a value is cached without affecting stats", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.PutWithTTL([]byte("expired"), []byte("value"), time.Nanosecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.Contains([]byte("key"))).Should(BeTrue())
+			Ω(l.Contains([]byte("missing"))).Should(BeFalse())
+			Ω(l.Contains([]byte("expired"))).Should(BeFalse())
+			Ω(l.Contains(nil)).Should(BeFalse())
+			Ω(l.hits).Should(Equal(int64(0)))
+			Ω(l.misses).Should(Equal(int64(0)))
+		})
+	})
+
+	Context("Put", func() {
+
+		It("should return an error when no key is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.Put(nil, []byte("value"))
+			Ω(err).Should(MatchError(ErrNoKey))
+		})
+
+		It("should return an error when no value is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.Put([]byte("key"), nil)
+			Ω(err).Should(MatchError(ErrNoValue))
+		})
+
+		It("should insert a value into the bolt database and the LRU cache", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			val := []byte("value")
+			err := l.Put([]byte("key"), val)
+			Ω(err).ShouldNot(HaveOccurred())
+			copy(val, "xxxxx")
+			Ω(l.puts).Should(Equal(int64(1)))
+			Ω(l.bput).Should(Equal(int64(5)))
+			Ω(l.reqs).Should(HaveLen(0))
+			v, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("value"))
+		})
+
+		It("should not be overwritten by a remote store request in progress", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			started := make(chan struct{})
+			release := make(chan struct{})
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				close(started)
+				<-release
+				return []byte("stale"), nil
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				v, err := l.Get([]byte("key"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(v)).Should(Equal("stale"))
+				close(done)
+			}()
+			<-started
+			err := l.Put([]byte("key"), []byte("fresh"))
+			Ω(err).ShouldNot(HaveOccurred())
+			close(release)
+			<-done
+			Consistently(func() string {
+				return string(l.getFromBolt([]byte("key")))
+			}, 20*time.Millisecond, time.Millisecond).Should(Equal("fresh"))
+			Ω(l.puts).Should(Equal(int64(1)))
+		})
+	})
+
+	Context("PutBuffer", func() {
+
+		It("should return an error when no buffer is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.PutBuffer([]byte("key"), nil)
+			Ω(err).Should(MatchError(ErrNoValue))
+		})
+
+		It("should insert the buffer's contents into the cache", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			buf := newBufferFromData([]byte("value"))
+			err := l.PutBuffer([]byte("key"), buf)
+			Ω(err).ShouldNot(HaveOccurred())
+			buf.Close()
+			v := l.getFromBolt([]byte("key"))
+			Ω(string(v)).Should(Equal("value"))
+		})
+	})
+
 	Context("hit", func() {
 
 		It("should return false and increment misses when a cache miss occurs", func() {
@@ -228,6 +583,136 @@ var _ = Describe("LRU", func() {
 		})
 	})
 
+	Context("Delete", func() {
+
+		It("should delete values from the LRU and underlying bolt database", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			for i := 0; i < 4; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), []byte("value"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			err := l.Delete([]byte("1"), []byte("2"), []byte("missing"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.lru.Len()).Should(Equal(int64(2)))
+			Ω(l.getFromBolt([]byte("1"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("2"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("0"))).ShouldNot(BeNil())
+			Ω(l.getFromBolt([]byte("3"))).ShouldNot(BeNil())
+			Ω(l.deleted).Should(Equal(int64(2)))
+			Ω(l.bdeleted).Should(Equal(int64(10)))
+		})
+
+		It("should prevent a remote store request in progress from caching its value", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			started := make(chan struct{})
+			release := make(chan struct{})
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				close(started)
+				<-release
+				return []byte("value"), nil
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := l.Get([]byte("key"))
+				Ω(err).ShouldNot(HaveOccurred())
+				close(done)
+			}()
+			<-started
+			err := l.Delete([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			close(release)
+			<-done
+			Consistently(func() []byte {
+				return l.getFromBolt([]byte("key"))
+			}, 20*time.Millisecond, time.Millisecond).Should(BeNil())
+		})
+	})
+
+	Context("DeletePrefix", func() {
+
+		It("should return an error when no prefix is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.DeletePrefix(nil)
+			Ω(err).Should(MatchError(ErrNoKey))
+		})
+
+		It("should delete all values with keys beginning with the prefix", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			keys := []string{"a/1", "a/2", "ab/1", "b/1", "a"}
+			for _, key := range keys {
+				err := l.put([]byte(key), []byte("value"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			err := l.DeletePrefix([]byte("a/"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.lru.Len()).Should(Equal(int64(3)))
+			Ω(l.getFromBolt([]byte("a/1"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("a/2"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("ab/1"))).ShouldNot(BeNil())
+			Ω(l.getFromBolt([]byte("b/1"))).ShouldNot(BeNil())
+			Ω(l.getFromBolt([]byte("a"))).ShouldNot(BeNil())
+			s := l.Stats()
+			Ω(s.Deleted).Should(Equal(int64(2)))
+			Ω(s.DeletedBytes).Should(Equal(int64(10)))
+		})
+
+		It("should cancel matching remote store requests in progress", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			r := &req{}
+			l.reqs["a/1"] = r
+			l.reqs["b/1"] = &req{}
+			err := l.DeletePrefix([]byte("a/"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.cancelled).Should(BeTrue())
+			Ω(l.reqs).Should(HaveLen(1))
+			Ω(l.reqs).Should(HaveKey("b/1"))
+		})
+	})
+
+	Context("DeleteRange", func() {
+
+		It("should delete all values with keys within the range", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			for i := 0; i < 6; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), []byte("value"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			err := l.DeleteRange([]byte("1"), []byte("4"))
+			Ω(err).ShouldNot(HaveOccurred())
+			for i := 0; i < 6; i++ {
+				v := l.getFromBolt([]byte(strconv.Itoa(i)))
+				if i >= 1 && i < 4 {
+					Ω(v).Should(BeNil())
+				} else {
+					Ω(v).ShouldNot(BeNil())
+				}
+			}
+			Ω(l.lru.Len()).Should(Equal(int64(3)))
+			Ω(l.Stats().Deleted).Should(Equal(int64(3)))
+		})
+
+		It("should delete all values following the start key when no end is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			for i := 0; i < 6; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), []byte("value"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			err := l.DeleteRange([]byte("3"), nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.lru.Len()).Should(Equal(int64(3)))
+			Ω(l.getFromBolt([]byte("2"))).ShouldNot(BeNil())
+			Ω(l.getFromBolt([]byte("5"))).Should(BeNil())
+		})
+	})
+
 	Context("Empty", func() {
 
 		It("should empty the LRU and underlying bolt database", func() {
@@ -0,0 +1,194 @@
+package lru
+
+import (
+	"errors"
+	"fmt"
+)
+
+// getMultiConcurrency is the maximum number of concurrent requests made to a
+// remote store that isn't a BatchStore during a call to GetMulti.
+const getMultiConcurrency = 16
+
+// errBatchLen is the error returned for all keys when a BatchStore returns a
+// different number of values or errors than the number of keys requested.
+var errBatchLen = errors.New("invalid number of results returned from the store")
+
+// GetMulti attempts to retrieve the values for all of the provided keys,
+// returning a slice of values and a slice of errors with the same length and
+// order as the provided keys. Each index holds either the value or the error
+// for the corresponding key. All values found in the local cache are read
+// within a single transaction. Missing values are retrieved from the remote
+// store, sharing any requests already in progress for the same keys. If the
+// LRU's store is a BatchStore, all remaining values are requested in a single
+// call to its GetMulti method; otherwise, they are requested concurrently.
+// Byte slices returned by this method should not be modified.
+func (l *LRU) GetMulti(keys [][]byte) ([][]byte, []error) {
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	// register hits and misses in the LRU
+	sizes := make([]int64, len(keys))
+	var hits [][]byte
+	for i, key := range keys {
+		if len(key) == 0 {
+			errs[i] = ErrNoKey
+			sizes[i] = -1
+			continue
+		}
+		if sizes[i] = l.hit(key); sizes[i] >= 0 {
+			hits = append(hits, key)
+		}
+	}
+
+	// attempt to get all hits from the local cache
+	var misses []int
+	hitVals := l.getMultiFromBolt(hits)
+	for i := range keys {
+		if errs[i] != nil {
+			continue
+		}
+		if sizes[i] >= 0 {
+			vals[i], hitVals = hitVals[0], hitVals[1:]
+			if vals[i] != nil {
+				continue
+			}
+			l.hitToMiss(sizes[i])
+		}
+		misses = append(misses, i)
+	}
+	if len(misses) == 0 {
+		return vals, errs
+	}
+
+	// register requests for all misses, sharing those in progress
+	ttl := l.defaultTTL()
+	reqs := make([]*req, len(misses))
+	var newKeys [][]byte
+	var newReqs []*req
+	l.muReqs.Lock()
+	for j, i := range misses {
+		r, ok := l.reqs[string(keys[i])]
+		if !ok {
+			k := make([]byte, len(keys[i]))
+			copy(k, keys[i])
+			r = newReq(ttl)
+			l.reqs[string(k)] = r
+			newKeys = append(newKeys, k)
+			newReqs = append(newReqs, r)
+		}
+		r.waiters++
+		if r.s != nil {
+			// the request is streamed, hold on to its staged chunks
+			r.s.ref()
+		}
+		reqs[j] = r
+	}
+	l.muReqs.Unlock()
+
+	// retrieve the new requests from the remote store and wait for all
+	// requests to complete
+	if len(newReqs) > 0 {
+		go l.fetchMulti(newKeys, newReqs)
+	}
+	for j, i := range misses {
+		r := reqs[j]
+		<-r.done
+		vals[i], errs[i] = l.reqValue(r)
+		if r.s != nil {
+			r.s.unref()
+		}
+	}
+	return vals, errs
+}
+
+// fetchMulti obtains the results of the provided registered requests from the
+// remote store and writes all values received into the cache.
+func (l *LRU) fetchMulti(keys [][]byte, reqs []*req) {
+	bs, ok := batchStore(l.store)
+	if !ok {
+		// request each value concurrently with a limited number of
+		// goroutines
+		sem := make(chan struct{}, getMultiConcurrency)
+		for i := range keys {
+			sem <- struct{}{}
+			go func(key []byte, r *req) {
+				l.fetchReq(key, r, l.fetchFromStore)
+				<-sem
+			}(keys[i], reqs[i])
+		}
+		return
+	}
+
+	vals, errs := l.getMultiResFromStore(bs, keys)
+	for i, r := range reqs {
+		r.complete(vals[i], errs[i])
+	}
+	// write the received values concurrently, allowing the bolt database
+	// to combine the writes into fewer transactions
+	for i, r := range reqs {
+		if r.err != nil {
+			l.deleteReq(keys[i], r)
+			continue
+		}
+		go func(key []byte, r *req) {
+			l.putReq(key, r)
+			l.deleteReq(key, r)
+		}(keys[i], r)
+	}
+}
+
+// getMultiResFromStore attempts to retrieve the values corresponding to the
+// provided keys from the provided batch store, skipping any keys with writes
+// queued in the journal or in the negative cache. If the store's GetMulti
+// method panics, the panic is recovered and an error is returned for every key.
+func (l *LRU) getMultiResFromStore(bs BatchStore, keys [][]byte) (vals [][]byte, errs []error) {
+	vals = make([][]byte, len(keys))
+	errs = make([]error, len(keys))
+
+	// skip keys with writes queued in the journal and keys the store
+	// recently reported as having no value
+	var idx []int
+	var missing [][]byte
+	for i, key := range keys {
+		if e := l.pendingWrite(key); e != nil {
+			vals[i], errs[i] = e.result()
+			continue
+		}
+		if errs[i] = l.getNegative(key); errs[i] == nil {
+			idx = append(idx, i)
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	// recover from a panic by returning an error for every requested key
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("panic: %v", r)
+			for _, i := range idx {
+				vals[i], errs[i] = nil, err
+			}
+		}
+	}()
+	bvals, berrs := bs.GetMulti(missing)
+	if len(bvals) != len(missing) || len(berrs) != len(missing) {
+		for _, i := range idx {
+			errs[i] = errBatchLen
+		}
+		return
+	}
+	// ensure that exactly one of the value or error is nil for each key
+	for j, i := range idx {
+		if berrs[j] != nil {
+			errs[i] = berrs[j]
+		} else if bvals[j] == nil {
+			errs[i] = ErrNoValue
+		} else {
+			vals[i] = bvals[j]
+		}
+		l.putNegative(keys[i], errs[i])
+	}
+	return
+}
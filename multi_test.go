@@ -0,0 +1,131 @@
+package lru
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multi", func() {
+
+	Context("GetMulti", func() {
+
+		It("should return values from the local cache and the remote store", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			for i := 0; i < 2; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), []byte("cached"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			var reqs int64
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				atomic.AddInt64(&reqs, 1)
+				if string(key) == "missing" {
+					return nil, ErrNotFound
+				}
+				return []byte("remote"), nil
+			})
+			keys := [][]byte{[]byte("0"), []byte("2"), nil, []byte("1"), []byte("missing"), []byte("2")}
+			vals, errs := l.GetMulti(keys)
+			Ω(vals).Should(HaveLen(6))
+			Ω(errs).Should(HaveLen(6))
+			Ω(string(vals[0])).Should(Equal("cached"))
+			Ω(string(vals[1])).Should(Equal("remote"))
+			Ω(errs[2]).Should(MatchError(ErrNoKey))
+			Ω(string(vals[3])).Should(Equal("cached"))
+			Ω(errs[4]).Should(MatchError(ErrNotFound))
+			Ω(vals[4]).Should(BeNil())
+			Ω(string(vals[5])).Should(Equal("remote"))
+			Ω(reqs).Should(Equal(int64(2)))
+			Ω(l.hits).Should(Equal(int64(2)))
+			Ω(l.misses).Should(Equal(int64(3)))
+		})
+
+		It("should retrieve all missing values in a single call to a BatchStore", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("0"), []byte("cached"))
+			Ω(err).ShouldNot(HaveOccurred())
+			var calls int64
+			bs := &testBatchStore{getMulti: func(keys [][]byte) ([][]byte, []error) {
+				atomic.AddInt64(&calls, 1)
+				Ω(keys).Should(HaveLen(3))
+				vals := make([][]byte, len(keys))
+				errs := make([]error, len(keys))
+				for i, key := range keys {
+					if string(key) == "3" {
+						errs[i] = errors.New("test error")
+						continue
+					}
+					vals[i] = []byte("remote" + string(key))
+				}
+				return vals, errs
+			}}
+			l.store = bs
+			keys := [][]byte{[]byte("0"), []byte("1"), []byte("2"), []byte("3")}
+			vals, errs := l.GetMulti(keys)
+			Ω(calls).Should(Equal(int64(1)))
+			Ω(string(vals[0])).Should(Equal("cached"))
+			Ω(string(vals[1])).Should(Equal("remote1"))
+			Ω(string(vals[2])).Should(Equal("remote2"))
+			Ω(errs[3]).Should(MatchError("test error"))
+			Eventually(func() []byte {
+				return l.getFromBolt([]byte("2"))
+			}).ShouldNot(BeNil())
+		})
+
+		It("should return an error for every key when a BatchStore returns invalid results", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &testBatchStore{getMulti: func(keys [][]byte) ([][]byte, []error) {
+				return nil, nil
+			}}
+			_, errs := l.GetMulti([][]byte{[]byte("0"), []byte("1")})
+			Ω(errs[0]).Should(MatchError(errBatchLen))
+			Ω(errs[1]).Should(MatchError(errBatchLen))
+		})
+
+		It("should recover from a panic in a BatchStore's GetMulti", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &testBatchStore{getMulti: func(keys [][]byte) ([][]byte, []error) {
+				panic("error message")
+			}}
+			vals, errs := l.GetMulti([][]byte{[]byte("0"), []byte("1")})
+			Ω(vals[0]).Should(BeNil())
+			Ω(errs[0]).Should(MatchError("panic: error message"))
+			Ω(errs[1]).Should(MatchError("panic: error message"))
+		})
+
+		It("should share requests already in progress for the same keys", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			r := newReq(0)
+			l.reqs["key"] = r
+			go r.complete([]byte("value"), nil)
+			vals, errs := l.GetMulti([][]byte{[]byte("key")})
+			Ω(errs[0]).ShouldNot(HaveOccurred())
+			Ω(string(vals[0])).Should(Equal("value"))
+		})
+	})
+})
+
+type testBatchStore struct {
+	getMulti func([][]byte) ([][]byte, []error)
+}
+
+func (s *testBatchStore) Open() error {
+	return nil
+}
+func (s *testBatchStore) Close() error {
+	return nil
+}
+func (s *testBatchStore) Get(key []byte) ([]byte, error) {
+	return nil, errors.New("unexpected Get")
+}
+func (s *testBatchStore) GetMulti(keys [][]byte) ([][]byte, []error) {
+	return s.getMulti(keys)
+}
@@ -0,0 +1,148 @@
+package lru
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"time"
+)
+
+// negCache is a bounded in-memory cache of keys for which the remote store
+// reported that no value exists. Entries expire after the cache's TTL, and the
+// least recently inserted entries are dropped when the cache is full.
+type negCache struct {
+	mu    sync.Mutex
+	items map[string]*list.Element
+	list  *list.List
+	cap   int
+	ttl   time.Duration
+}
+
+// negItem represents a single entry in the negative cache.
+type negItem struct {
+	key string    // the item's key
+	err error     // the error returned by the remote store
+	exp time.Time // the item's expiration time
+}
+
+// newNegCache returns a new negCache holding at most cap entries for the
+// provided TTL.
+func newNegCache(cap int, ttl time.Duration) *negCache {
+	return &negCache{
+		items: make(map[string]*list.Element),
+		list:  list.New(),
+		cap:   cap,
+		ttl:   ttl,
+	}
+}
+
+// get returns the cached error for the provided key, or nil if the key isn't in
+// the cache or its entry has expired.
+func (nc *negCache) get(key []byte) error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	elem, ok := nc.items[string(key)]
+	if !ok {
+		return nil
+	}
+	i := elem.Value.(*negItem)
+	if !time.Now().Before(i.exp) {
+		nc.list.Remove(elem)
+		delete(nc.items, i.key)
+		return nil
+	}
+	return i.err
+}
+
+// put inserts the provided key and error into the cache, dropping the oldest
+// entries if the cache exceeds its capacity.
+func (nc *negCache) put(key []byte, err error) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if elem, ok := nc.items[string(key)]; ok {
+		nc.list.Remove(elem)
+	}
+	i := &negItem{key: string(key), err: err, exp: time.Now().Add(nc.ttl)}
+	nc.items[i.key] = nc.list.PushFront(i)
+	for nc.list.Len() > nc.cap {
+		i := nc.list.Remove(nc.list.Back()).(*negItem)
+		delete(nc.items, i.key)
+	}
+}
+
+// remove removes the provided keys from the cache.
+func (nc *negCache) remove(keys ...[]byte) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := nc.items[string(key)]; ok {
+			nc.list.Remove(elem)
+			delete(nc.items, string(key))
+		}
+	}
+}
+
+// removeMatching removes all keys greater than or equal to seek that satisfy
+// the provided match function from the cache.
+func (nc *negCache) removeMatching(seek []byte, match func([]byte) bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for key, elem := range nc.items {
+		if k := []byte(key); bytes.Compare(k, seek) >= 0 && match(k) {
+			nc.list.Remove(elem)
+			delete(nc.items, key)
+		}
+	}
+}
+
+// empty removes all entries from the cache.
+func (nc *negCache) empty() {
+	nc.mu.Lock()
+	nc.items = make(map[string]*list.Element)
+	nc.list = list.New()
+	nc.mu.Unlock()
+}
+
+// SetNegativeCache enables caching the keys for which the remote store reports
+// that no value exists (see IsNotFound). Up to size keys are remembered for the
+// provided TTL, during which a Get for the same key returns the store's
+// original error without contacting the remote store again. A size or TTL that
+// is not positive disables the negative cache, which is the default. This
+// method must be called before Open.
+func (l *LRU) SetNegativeCache(size int, ttl time.Duration) {
+	if size <= 0 || ttl <= 0 {
+		l.neg = nil
+		return
+	}
+	l.neg = newNegCache(size, ttl)
+}
+
+// getNegative returns the cached remote store error for the provided key, or
+// nil if the key isn't in the negative cache.
+func (l *LRU) getNegative(key []byte) error {
+	if l.neg == nil {
+		return nil
+	}
+	err := l.neg.get(key)
+	if err != nil {
+		l.mu.Lock()
+		l.negHits++
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// putNegative inserts the provided key into the negative cache if the provided
+// remote store error indicates that no value exists.
+func (l *LRU) putNegative(key []byte, err error) {
+	if l.neg != nil && IsNotFound(err) {
+		l.neg.put(key, err)
+	}
+}
+
+// removeNegative removes the provided keys from the negative cache.
+func (l *LRU) removeNegative(keys ...[]byte) {
+	if l.neg != nil {
+		l.neg.remove(keys...)
+	}
+}
@@ -0,0 +1,142 @@
+package lru
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Negcache", func() {
+
+	Context("negCache", func() {
+
+		It("should return nil for a key that doesn't exist", func() {
+			nc := newNegCache(10, time.Hour)
+			Ω(nc.get([]byte("key"))).Should(BeNil())
+		})
+
+		It("should return the cached error until it expires", func() {
+			nc := newNegCache(10, 5*time.Millisecond)
+			nc.put([]byte("key"), ErrNotFound)
+			Ω(nc.get([]byte("key"))).Should(MatchError(ErrNotFound))
+			time.Sleep(5 * time.Millisecond)
+			Ω(nc.get([]byte("key"))).Should(BeNil())
+			Ω(nc.items).Should(HaveLen(0))
+		})
+
+		It("should drop the oldest entries when exceeding its capacity", func() {
+			nc := newNegCache(3, time.Hour)
+			for i := 0; i < 5; i++ {
+				nc.put([]byte(strconv.Itoa(i)), ErrNotFound)
+			}
+			Ω(nc.list.Len()).Should(Equal(3))
+			Ω(nc.get([]byte("1"))).Should(BeNil())
+			Ω(nc.get([]byte("2"))).ShouldNot(BeNil())
+			Ω(nc.get([]byte("4"))).ShouldNot(BeNil())
+		})
+
+		It("should remove keys from the cache", func() {
+			nc := newNegCache(10, time.Hour)
+			for _, key := range []string{"a/1", "a/2", "b/1"} {
+				nc.put([]byte(key), ErrNotFound)
+			}
+			nc.remove([]byte("b/1"))
+			Ω(nc.get([]byte("b/1"))).Should(BeNil())
+			nc.removeMatching([]byte("a/"), func(k []byte) bool {
+				return k[0] == 'a'
+			})
+			Ω(nc.items).Should(HaveLen(0))
+			Ω(nc.list.Len()).Should(Equal(0))
+		})
+	})
+
+	Context("IsNotFound", func() {
+
+		It("should recognize errors indicating that no value exists", func() {
+			Ω(IsNotFound(ErrNotFound)).Should(BeTrue())
+			Ω(IsNotFound(ErrNoValue)).Should(BeTrue())
+			Ω(IsNotFound(notFoundErr{})).Should(BeTrue())
+			Ω(IsNotFound(errors.New("test error"))).Should(BeFalse())
+			Ω(IsNotFound(nil)).Should(BeFalse())
+		})
+	})
+
+	Context("SetNegativeCache", func() {
+
+		It("should not contact the remote store again for a key that wasn't found", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), nil)
+			l.SetNegativeCache(10, time.Hour)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			var reqs int64
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				atomic.AddInt64(&reqs, 1)
+				return nil, ErrNotFound
+			})
+			for i := 0; i < 3; i++ {
+				_, err := l.Get([]byte("key"))
+				Ω(err).Should(MatchError(ErrNotFound))
+			}
+			Ω(reqs).Should(Equal(int64(1)))
+			s := l.Stats()
+			Ω(s.Misses).Should(Equal(int64(3)))
+			Ω(s.NegativeHits).Should(Equal(int64(2)))
+		})
+
+		It("should not cache other remote store errors", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), nil)
+			l.SetNegativeCache(10, time.Hour)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				return nil, errors.New("test error")
+			})
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			for i := 0; i < 2; i++ {
+				_, err := l.Get([]byte("key"))
+				Ω(err).Should(HaveOccurred())
+			}
+			Ω(l.Stats().NegativeHits).Should(Equal(int64(0)))
+		})
+
+		It("should forget a key once a value is put into the cache", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), nil)
+			l.SetNegativeCache(10, time.Hour)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				return nil, nil
+			})
+			_, err = l.Get([]byte("key"))
+			Ω(err).Should(MatchError(ErrNoValue))
+			err = l.Put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.neg.get([]byte("key"))).Should(BeNil())
+			err = l.Delete([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			l.neg.put([]byte("key"), ErrNotFound)
+			err = l.Empty()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.neg.get([]byte("key"))).Should(BeNil())
+		})
+
+		It("should be disabled when given an invalid size or TTL", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), nil)
+			l.SetNegativeCache(0, time.Hour)
+			Ω(l.neg).Should(BeNil())
+			l.SetNegativeCache(10, 0)
+			Ω(l.neg).Should(BeNil())
+		})
+	})
+})
+
+type notFoundErr struct{}
+
+func (e notFoundErr) Error() string  { return "not found" }
+func (e notFoundErr) NotFound() bool { return true }
@@ -0,0 +1,81 @@
+package lru
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidRange is the error returned by GetRange when the requested range is
+// invalid or begins past the end of the value.
+var ErrInvalidRange = errors.New("invalid range")
+
+// GetRange attempts to retrieve up to length bytes of the value for the
+// provided key, starting at the provided offset. A negative length retrieves
+// all of the bytes following the offset. A value in the local cache is read
+// without copying any bytes outside of the range. If the value is missing and
+// the LRU's store is a RangeStore, the range is retrieved with its GetRange
+// method while the complete value is retrieved and cached in the background;
+// otherwise, the complete value is retrieved from the remote store before
+// returning the range. ErrInvalidRange is returned if the offset is negative
+// or past the end of the value.
+func (l *LRU) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	if offset < 0 {
+		return nil, ErrInvalidRange
+	}
+	// attempt to get the range from local cache
+	if size := l.hit(key); size >= 0 {
+		v, err := l.getRangeFromBolt(key, offset, length)
+		if v != nil || err != nil {
+			return v, err
+		}
+		l.hitToMiss(size)
+	}
+	// retrieve the range from the remote store, unless a write of the key is
+	// queued in the journal
+	if rs, ok := rangeStore(l.store); ok && !l.isPending(key) {
+		return l.fetchRange(rs, key, offset, length)
+	}
+	v, err := l.getFromStore(key)
+	if err != nil {
+		return nil, err
+	}
+	return sliceRange(v, offset, length)
+}
+
+// fetchRange retrieves the provided range of the value for the provided key
+// from the provided RangeStore, and retrieves the complete value from the
+// remote store in the background.
+func (l *LRU) fetchRange(rs RangeStore, key []byte, offset, length int64) ([]byte, error) {
+	// return the cached error if the store recently reported that no value
+	// exists
+	if err := l.getNegative(key); err != nil {
+		return nil, err
+	}
+	l.refresh(key)
+	v, err := l.getRes(context.Background(), key, func(_ context.Context, key []byte) ([]byte, error) {
+		return rs.GetRange(key, offset, length)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if length >= 0 && int64(len(v)) > length {
+		v = v[:length]
+	}
+	return v, nil
+}
+
+// sliceRange returns the provided range of the provided value without copying
+// it. ErrInvalidRange is returned if the offset is past the end of the value.
+func sliceRange(v []byte, offset, length int64) ([]byte, error) {
+	if offset > int64(len(v)) {
+		return nil, ErrInvalidRange
+	}
+	v = v[offset:]
+	if length >= 0 && length < int64(len(v)) {
+		v = v[:length]
+	}
+	return v, nil
+}
@@ -0,0 +1,149 @@
+package lru
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Range", func() {
+
+	Context("GetRange", func() {
+
+		It("should return an error when no key or an invalid offset is provided", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			_, err := l.GetRange(nil, 0, 1)
+			Ω(err).Should(MatchError(ErrNoKey))
+			_, err = l.GetRange([]byte("key"), -1, 1)
+			Ω(err).Should(MatchError(ErrInvalidRange))
+		})
+
+		It("should return a range of a value from the local bolt cache", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			l.store = &errStore{}
+			v, err := l.GetRange([]byte("key"), 1, 3)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("alu"))
+			v, err = l.GetRange([]byte("key"), 2, -1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("lue"))
+			v, err = l.GetRange([]byte("key"), 5, 10)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(BeEmpty())
+			_, err = l.GetRange([]byte("key"), 6, 1)
+			Ω(err).Should(MatchError(ErrInvalidRange))
+			stats := l.Stats()
+			Ω(stats.Hits).Should(Equal(int64(4)))
+		})
+
+		It("should return an error when reading the local bolt cache fails", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.db.Close()).Should(Succeed())
+			v, err := l.getRangeFromBolt([]byte("key"), 1, 3)
+			Ω(err).Should(HaveOccurred())
+			Ω(v).Should(BeNil())
+		})
+
+		It("should return a range of a complete value from the remote store", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				return []byte("value"), nil
+			})
+			v, err := l.GetRange([]byte("key"), 1, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("al"))
+			Eventually(func() []byte {
+				return l.getFromBolt([]byte("key"))
+			}).Should(Equal([]byte("value")))
+			_, err = l.GetRange([]byte("other"), 6, 1)
+			Ω(err).Should(MatchError(ErrInvalidRange))
+		})
+
+		It("should return a range from a RangeStore and cache the complete value in the background", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			var gets int64
+			l.store = &testRangeStore{
+				get: func(key []byte) ([]byte, error) {
+					atomic.AddInt64(&gets, 1)
+					return []byte("value"), nil
+				},
+				getRange: func(key []byte, offset, length int64) ([]byte, error) {
+					Ω(offset).Should(Equal(int64(1)))
+					Ω(length).Should(Equal(int64(2)))
+					return []byte("alue"), nil
+				},
+			}
+			v, err := l.GetRange([]byte("key"), 1, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("al"))
+			Eventually(func() []byte {
+				return l.getFromBolt([]byte("key"))
+			}).Should(Equal([]byte("value")))
+			Ω(atomic.LoadInt64(&gets)).Should(Equal(int64(1)))
+		})
+
+		It("should return an error from a RangeStore", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &testRangeStore{
+				get: func(key []byte) ([]byte, error) {
+					return nil, errors.New("test error")
+				},
+				getRange: func(key []byte, offset, length int64) ([]byte, error) {
+					panic("error message")
+				},
+			}
+			_, err := l.GetRange([]byte("key"), 0, 1)
+			Ω(err).Should(MatchError("panic: error message"))
+		})
+
+		It("should return the cached error for a key in the negative cache", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetNegativeCache(10, time.Minute)
+			l.store = &testRangeStore{
+				get: func(key []byte) ([]byte, error) {
+					return nil, ErrNotFound
+				},
+				getRange: func(key []byte, offset, length int64) ([]byte, error) {
+					Fail("GetRange called")
+					return nil, nil
+				},
+			}
+			_, err := l.Get([]byte("key"))
+			Ω(err).Should(MatchError(ErrNotFound))
+			_, err = l.GetRange([]byte("key"), 0, 1)
+			Ω(err).Should(MatchError(ErrNotFound))
+		})
+	})
+})
+
+type testRangeStore struct {
+	get      func([]byte) ([]byte, error)
+	getRange func([]byte, int64, int64) ([]byte, error)
+}
+
+func (s *testRangeStore) Open() error {
+	return nil
+}
+func (s *testRangeStore) Close() error {
+	return nil
+}
+func (s *testRangeStore) Get(key []byte) ([]byte, error) {
+	return s.get(key)
+}
+func (s *testRangeStore) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	return s.getRange(key, offset, length)
+}
@@ -0,0 +1,104 @@
+package lru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrReaderClosed is returned when reading from a Reader that has been closed.
+var ErrReaderClosed = errors.New("reader closed")
+
+// Reader represents a value obtained from the cache that is read without being
+// copied. A Reader implements io.ReadCloser, io.ReaderAt, io.Seeker and
+// io.WriterTo. While a Reader is open, it holds the bolt read transaction of
+// the value's memory, or its share of the value's stream from the remote
+// store. After using a Reader, its Close method should be called to release
+// them. A Reader's methods cannot be called concurrently with its Close method.
+type Reader struct {
+	tx *bolt.Tx
+	r  valueReader
+}
+
+// valueReader is the interface of the underlying reader of a Reader.
+type valueReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.WriterTo
+	Size() int64
+}
+
+// newReader returns a new Reader over the provided byte slice. The provided
+// transaction, if any, is rolled back when the Reader is closed.
+func newReader(tx *bolt.Tx, data []byte) *Reader {
+	return &Reader{tx: tx, r: bytes.NewReader(data)}
+}
+
+// Read reads up to len(p) bytes of the value into p and returns the number of
+// bytes read and any error encountered.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		return 0, ErrReaderClosed
+	}
+	return r.r.Read(p)
+}
+
+// ReadAt reads len(p) bytes of the value into p starting at the provided offset
+// and returns the number of bytes read and any error encountered.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if r.r == nil {
+		return 0, ErrReaderClosed
+	}
+	return r.r.ReadAt(p, off)
+}
+
+// Seek sets the offset for the next Read according to whence, as defined by
+// io.Seeker, and returns the new offset.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if r.r == nil {
+		return 0, ErrReaderClosed
+	}
+	return r.r.Seek(offset, whence)
+}
+
+// WriteTo writes the remainder of the value to the provided io.Writer and
+// returns the number of bytes written and any error encountered.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	if r.r == nil {
+		return 0, ErrReaderClosed
+	}
+	return r.r.WriteTo(w)
+}
+
+// Size returns the total size of the value in bytes, or 0 once the Reader has
+// been closed. The size of a streamed value is -1 if it is unknown until the
+// stream is complete.
+func (r *Reader) Size() int64 {
+	if r.r == nil {
+		return 0
+	}
+	return r.r.Size()
+}
+
+// Close releases the Reader's bolt read transaction or stream, if any, and
+// returns any error encountered. After Close, the Reader can no longer be read
+// from.
+func (r *Reader) Close() error {
+	if r.r == nil {
+		return nil
+	}
+	c, _ := r.r.(io.Closer)
+	r.r = nil
+	if c != nil {
+		return c.Close()
+	}
+	if r.tx == nil {
+		return nil
+	}
+	tx := r.tx
+	r.tx = nil
+	return tx.Rollback()
+}
@@ -0,0 +1,60 @@
+package lru
+
+import (
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+
+	It("should read, seek and read at offsets within the value", func() {
+		r := newReader(nil, []byte("value"))
+		Ω(r.Size()).Should(Equal(int64(5)))
+		p := make([]byte, 3)
+		n, err := r.ReadAt(p, 2)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(n).Should(Equal(3))
+		Ω(string(p)).Should(Equal("lue"))
+		off, err := r.Seek(1, io.SeekStart)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(off).Should(Equal(int64(1)))
+		v, err := ioutil.ReadAll(r)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(v)).Should(Equal("alue"))
+	})
+
+	It("should return an error when used after being closed", func() {
+		r := newReader(nil, []byte("value"))
+		err := r.Close()
+		Ω(err).ShouldNot(HaveOccurred())
+		err = r.Close()
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = r.Read(make([]byte, 1))
+		Ω(err).Should(Equal(ErrReaderClosed))
+		_, err = r.ReadAt(make([]byte, 1), 0)
+		Ω(err).Should(Equal(ErrReaderClosed))
+		_, err = r.Seek(0, io.SeekStart)
+		Ω(err).Should(Equal(ErrReaderClosed))
+		_, err = r.WriteTo(ioutil.Discard)
+		Ω(err).Should(Equal(ErrReaderClosed))
+		Ω(r.Size()).Should(Equal(int64(0)))
+	})
+
+	It("should release its transaction when closed", func() {
+		l := newDefaultLRU()
+		defer closeBoltDB(l)
+		err := l.put([]byte("key"), []byte("value"))
+		Ω(err).ShouldNot(HaveOccurred())
+		r := l.getReaderFromBolt([]byte("key"))
+		Ω(r).ShouldNot(BeNil())
+		Ω(l.db.Stats().OpenTxN).Should(Equal(1))
+		err = r.Close()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(l.db.Stats().OpenTxN).Should(Equal(0))
+		Ω(l.getReaderFromBolt([]byte("missing"))).Should(BeNil())
+		Ω(l.db.Stats().OpenTxN).Should(Equal(0))
+	})
+})
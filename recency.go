@@ -0,0 +1,115 @@
+package lru
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// defaultCheckpointInterval is the default interval at which the state of the
+// LRU's algorithm is checkpointed.
+const defaultCheckpointInterval = 5 * time.Minute
+
+// recencyAlgorithm is implemented by Algorithms whose state is the recency
+// order of their items. Their state is checkpointed by walking their items and
+// restored by restoring them in the same order.
+type recencyAlgorithm interface {
+	Algorithm
+
+	// walk calls the provided function for every item, from the most to
+	// the least recently used, with the item's key, size and queue.
+	walk(func(key []byte, size int64, queue uint8))
+
+	// restore adds the provided key and size to the back of the provided
+	// queue and returns true if the key was successfully added. Items are
+	// restored from the most to the least recently used.
+	restore(key []byte, size int64, queue uint8) bool
+}
+
+// SetCheckpointInterval sets the interval at which the state of the LRU's
+// algorithm is checkpointed in the background, in addition to when the LRU is
+// closed. An interval that is not positive disables the background checkpoints.
+// This method must be called before Open.
+func (l *LRU) SetCheckpointInterval(interval time.Duration) {
+	l.cpInt = interval
+}
+
+// walkRecency returns the items of the provided algorithm from the most to the
+// least recently used. The items' keys are shared with the algorithm.
+func walkRecency(ra recencyAlgorithm) []stateItem {
+	var items []stateItem
+	ra.walk(func(key []byte, size int64, queue uint8) {
+		items = append(items, stateItem{key: key, size: size, status: queue})
+	})
+	return items
+}
+
+// restoreRecency empties the provided algorithm and restores the items of the
+// provided state encoded by encodeState in their recency order. The algorithm
+// is left unchanged if the state is invalid.
+func restoreRecency(ra recencyAlgorithm, state []byte) error {
+	items, err := decodeState(state)
+	if err != nil {
+		return err
+	}
+	ra.Empty()
+	for _, i := range items {
+		ra.restore(i.key, i.size, i.status)
+	}
+	return nil
+}
+
+// recencyState returns the state of the values in the provided bucket ordered
+// by the recency ranks persisted in the provided recency bucket, which is how
+// the recency order was checkpointed before algorithms could checkpoint their
+// state. Values without a persisted rank are placed last, in their original
+// order, in the warm queue.
+func recencyState(rb, b *bolt.Bucket) []byte {
+	var items []rankedItem
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		size := valueSize(b, k)
+		if size < 0 {
+			continue
+		}
+		i := rankedItem{rank: math.MaxUint64}
+		i.key = append([]byte(nil), k...)
+		i.size, i.status = size, twoQWarm
+		if v := rb.Get(k); v != nil {
+			i.rank, i.status = decodeRecency(v)
+		}
+		items = append(items, i)
+	}
+	sort.Stable(byRank(items))
+	state := make([]stateItem, len(items))
+	for n, i := range items {
+		state[n] = i.stateItem
+	}
+	return encodeState(state)
+}
+
+// rankedItem is an item along with its persisted recency rank.
+type rankedItem struct {
+	stateItem
+	rank uint64
+}
+
+// byRank sorts ranked items by their recency rank.
+type byRank []rankedItem
+
+func (r byRank) Len() int           { return len(r) }
+func (r byRank) Less(i, j int) bool { return r[i].rank < r[j].rank }
+func (r byRank) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// decodeRecency decodes a recency rank and queue persisted in a recency bucket
+// as 8 big-endian bytes followed by the queue. An invalid value is placed last
+// in the warm queue.
+func decodeRecency(b []byte) (uint64, uint8) {
+	if len(b) != 9 || b[8] > twoQWarm {
+		return math.MaxUint64, twoQWarm
+	}
+	return binary.BigEndian.Uint64(b), b[8]
+}
@@ -0,0 +1,126 @@
+package lru
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recency", func() {
+
+	Context("saveState", func() {
+
+		It("should restore TwoQ items into their lists in recency order", func() {
+			l := newDefaultLRU()
+			for i := 0; i < 4; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), make([]byte, 100))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			// promote "0" and then "2" to the hot LRU
+			l.hit([]byte("0"))
+			l.hit([]byte("2"))
+			err := l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			tq := l.lru.(*TwoQ)
+			Ω(tq.Len()).Should(Equal(int64(4)))
+			Ω(keysOf(tq.lruHot)).Should(Equal([]string{"2", "0"}))
+			Ω(keysOf(tq.lruWarm)).Should(Equal([]string{"3", "1"}))
+		})
+
+		It("should keep the most recently used items when the capacity is exceeded", func() {
+			l := NewLRU("", "", DefaultBasicLRU(10000), nil)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), make([]byte, 300))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			l.hit([]byte("0"))
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			l = NewLRU("", "", DefaultBasicLRU(1000), nil)
+			err = l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			Ω(l.lru.Len()).Should(Equal(int64(3)))
+			Ω(l.lru.Peek([]byte("0"))).Should(Equal(int64(300)))
+			Ω(l.lru.Peek([]byte("4"))).Should(Equal(int64(300)))
+			Ω(l.lru.Peek([]byte("3"))).Should(Equal(int64(300)))
+			Ω(l.getFromBolt([]byte("1"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("2"))).Should(BeNil())
+		})
+
+		It("should restore the recency order checkpointed by earlier versions", func() {
+			l := newDefaultLRU()
+			for i := 0; i < 4; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), make([]byte, 100))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			err := l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			// replace the checkpoint with recency ranks, leaving "3"
+			// without one
+			db, err := bolt.Open(l.dbPath, 0666, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = db.Update(func(tx *bolt.Tx) error {
+				if err := tx.Bucket(l.sName).Delete(stateKey); err != nil {
+					return err
+				}
+				rb, err := tx.CreateBucket(l.rName)
+				if err != nil {
+					return err
+				}
+				for rank, key := range []string{"2", "0", "1"} {
+					v := make([]byte, 9)
+					binary.BigEndian.PutUint64(v, uint64(rank))
+					v[8] = twoQWarm
+					if key == "2" {
+						v[8] = twoQHot
+					}
+					if err := rb.Put([]byte(key), v); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(db.Close()).Should(Succeed())
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			tq := l.lru.(*TwoQ)
+			Ω(keysOf(tq.lruHot)).Should(Equal([]string{"2"}))
+			Ω(keysOf(tq.lruWarm)).Should(Equal([]string{"0", "1", "3"}))
+			l.db.View(func(tx *bolt.Tx) error {
+				Ω(tx.Bucket(l.rName)).Should(BeNil())
+				return nil
+			})
+		})
+	})
+
+	Context("decodeRecency", func() {
+
+		It("should place an invalid value last in the warm queue", func() {
+			rank, queue := decodeRecency([]byte("bad"))
+			Ω(rank).Should(Equal(uint64(math.MaxUint64)))
+			Ω(queue).Should(Equal(uint8(twoQWarm)))
+		})
+	})
+})
+
+func keysOf(ll *twoQList) []string {
+	var keys []string
+	for e := ll.list.Front(); e != nil; e = e.Next() {
+		keys = append(keys, string(e.Value.(*twoQItem).key))
+	}
+	return keys
+}
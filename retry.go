@@ -0,0 +1,260 @@
+package lru
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRetryAttempts is the default maximum number of attempts made
+	// by a RetryStore to retrieve a value.
+	defaultRetryAttempts = 3
+
+	// defaultRetryMinBackoff is the default delay before the first retry
+	// of a RetryStore.
+	defaultRetryMinBackoff = 50 * time.Millisecond
+
+	// defaultRetryMaxBackoff is the default maximum delay between retries
+	// of a RetryStore.
+	defaultRetryMaxBackoff = 5 * time.Second
+
+	// defaultRetryJitter is the default jitter of a RetryStore's delays.
+	defaultRetryJitter = 0.5
+)
+
+// RetryStore is a Store that wraps another Store, retrying failed retrievals
+// with an exponential backoff. Retries stop once the retrieval's context is
+// done, or when its deadline would pass before the next retry.
+//
+// A RetryStore provides the optional interfaces of the wrapped store, such as
+// WritableStore or StreamStore, retrying their calls in the same manner. A
+// batch of values is retried as a whole while any of its keys fails with a
+// retryable error, and a stream is only retried until it is opened.
+type RetryStore struct {
+	store      Store
+	attempts   int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+	retryable  func(error) bool
+
+	mu      sync.Mutex
+	retries int64 // # of retries made
+}
+
+// NewRetryStore returns a new RetryStore wrapping the provided store. By
+// default, up to 3 attempts are made, with a backoff starting at 50ms and
+// capped at 5s, a jitter of 0.5, and all errors other than not found errors
+// and breaker open errors are retried.
+func NewRetryStore(store Store) *RetryStore {
+	return &RetryStore{
+		store:      store,
+		attempts:   defaultRetryAttempts,
+		minBackoff: defaultRetryMinBackoff,
+		maxBackoff: defaultRetryMaxBackoff,
+		jitter:     defaultRetryJitter,
+		retryable:  isRetryable,
+	}
+}
+
+// isRetryable returns true if the provided error is neither a not found error
+// nor a breaker open error.
+func isRetryable(err error) bool {
+	return !IsNotFound(err) && !IsBreakerOpen(err)
+}
+
+// SetMaxAttempts sets the maximum number of attempts made to retrieve a value,
+// including the first one. A value lower than 1 is treated as 1.
+func (s *RetryStore) SetMaxAttempts(attempts int) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	s.attempts = attempts
+}
+
+// SetBackoff sets the delay before the first retry, which doubles for each
+// subsequent retry up to the provided maximum delay.
+func (s *RetryStore) SetBackoff(min, max time.Duration) {
+	if max < min {
+		max = min
+	}
+	s.minBackoff, s.maxBackoff = min, max
+}
+
+// SetJitter sets the fraction, between 0 and 1, of each delay that is
+// randomized: a delay d is reduced by a random duration of up to jitter*d.
+func (s *RetryStore) SetJitter(jitter float64) {
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	s.jitter = jitter
+}
+
+// SetRetryable sets the function deciding whether a retrieval that failed with
+// the provided error is retried. A nil function restores the default, which
+// retries all errors other than not found errors and breaker open errors.
+func (s *RetryStore) SetRetryable(retryable func(error) bool) {
+	if retryable == nil {
+		retryable = isRetryable
+	}
+	s.retryable = retryable
+}
+
+// Open opens the wrapped store.
+func (s *RetryStore) Open() error {
+	return s.store.Open()
+}
+
+// Close closes the wrapped store.
+func (s *RetryStore) Close() error {
+	return s.store.Close()
+}
+
+// Get retrieves the value with the provided key from the wrapped store,
+// retrying retryable errors.
+func (s *RetryStore) Get(key []byte) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but passes the provided context to the wrapped store
+// if it is a ContextStore, and stops retrying once the context is done.
+func (s *RetryStore) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	var val []byte
+	err := s.retry(ctx, func(ctx context.Context) error {
+		var err error
+		val, err = storeGet(ctx, s.store, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetMulti retrieves the values with the provided keys from the wrapped store,
+// retrying the batch while any key fails with a retryable error. If the wrapped
+// store isn't a BatchStore, each value is retrieved with its Get method.
+func (s *RetryStore) GetMulti(keys [][]byte) ([][]byte, []error) {
+	var vals [][]byte
+	var errs []error
+	s.retry(context.Background(), func(context.Context) error {
+		vals, errs = storeGetMulti(s.store, keys)
+		return batchErr(errs)
+	})
+	return vals, errs
+}
+
+// GetRange retrieves the provided range of the value with the provided key from
+// the wrapped store, retrying retryable errors. If the wrapped store isn't a
+// RangeStore, the range is sliced from the complete value.
+func (s *RetryStore) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	var val []byte
+	err := s.retry(context.Background(), func(context.Context) error {
+		var err error
+		val, err = storeGetRange(s.store, key, offset, length)
+		return err
+	})
+	return val, err
+}
+
+// GetStream opens the stream of the value with the provided key from the
+// wrapped store, retrying retryable errors until it is opened. If the wrapped
+// store isn't a StreamStore, the complete value is retrieved and streamed.
+func (s *RetryStore) GetStream(key []byte) (io.ReadCloser, int64, error) {
+	var rc io.ReadCloser
+	var size int64
+	err := s.retry(context.Background(), func(context.Context) error {
+		var err error
+		rc, size, err = storeGetStream(s.store, key)
+		return err
+	})
+	return rc, size, err
+}
+
+// Put writes the provided key and value into the wrapped store, retrying
+// retryable errors. ErrNotWritable is returned if the wrapped store isn't a
+// WritableStore.
+func (s *RetryStore) Put(key, val []byte) error {
+	return s.retry(context.Background(), func(context.Context) error {
+		return storePut(s.store, key, val)
+	})
+}
+
+// Delete deletes the provided key from the wrapped store, retrying retryable
+// errors. ErrNotWritable is returned if the wrapped store isn't a
+// WritableStore.
+func (s *RetryStore) Delete(key []byte) error {
+	return s.retry(context.Background(), func(context.Context) error {
+		return storeDelete(s.store, key)
+	})
+}
+
+// wrapped returns the wrapped store.
+func (s *RetryStore) wrapped() Store {
+	return s.store
+}
+
+// retry calls the provided function with the provided context until it
+// succeeds, retrying retryable errors with an exponential backoff, and returns
+// its last error. Retries stop once the context is done.
+func (s *RetryStore) retry(ctx context.Context, fn func(context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || err == ErrNotWritable || attempt >= s.attempts || ctx.Err() != nil || !s.retryable(err) {
+			return err
+		}
+		delay := s.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		s.mu.Lock()
+		s.retries++
+		s.mu.Unlock()
+	}
+}
+
+// backoff returns the delay before the retry following the provided attempt.
+func (s *RetryStore) backoff(attempt int) time.Duration {
+	delay := s.minBackoff
+	for i := 1; i < attempt && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.maxBackoff {
+		delay = s.maxBackoff
+	}
+	return delay - time.Duration(rand.Float64()*s.jitter*float64(delay))
+}
+
+// StoreStats returns the RetryStore's current stats, added to those of the
+// wrapped store. Retries holds the number of retries made.
+func (s *RetryStore) StoreStats() StoreStats {
+	stats := storeStats(s.store, false)
+	s.mu.Lock()
+	stats.Retries += s.retries
+	s.mu.Unlock()
+	return stats
+}
+
+// ResetStoreStats resets the RetryStore's stats, along with those of the
+// wrapped store, and returns its stats as they were immediately before being
+// reset.
+func (s *RetryStore) ResetStoreStats() StoreStats {
+	stats := storeStats(s.store, true)
+	s.mu.Lock()
+	stats.Retries += s.retries
+	s.retries = 0
+	s.mu.Unlock()
+	return stats
+}
@@ -0,0 +1,176 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryStore", func() {
+
+	// failingStore returns a store failing the first "fails" retrievals
+	// with the provided error, and the number of retrievals made.
+	failingStore := func(fails int32, ferr error) (Store, *int32) {
+		var calls int32
+		return newStore(func(key []byte) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) <= fails {
+				return nil, ferr
+			}
+			return []byte("value"), nil
+		}), &calls
+	}
+
+	Context("Get", func() {
+
+		It("should retry failed retrievals", func() {
+			st, calls := failingStore(2, errors.New("test error"))
+			s := NewRetryStore(st)
+			s.SetBackoff(time.Millisecond, 10*time.Millisecond)
+			v, err := s.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("value")))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(3)))
+			Ω(s.StoreStats().Retries).Should(Equal(int64(2)))
+		})
+
+		It("should give up after the maximum number of attempts", func() {
+			st, calls := failingStore(5, errors.New("test error"))
+			s := NewRetryStore(st)
+			s.SetBackoff(time.Millisecond, 10*time.Millisecond)
+			s.SetMaxAttempts(4)
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(MatchError("test error"))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(4)))
+		})
+
+		It("should only retry retryable errors", func() {
+			st, calls := failingStore(1, ErrNotFound)
+			s := NewRetryStore(st)
+			_, err := s.Get([]byte("key"))
+			Ω(err).Should(Equal(ErrNotFound))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(1)))
+
+			st, calls = failingStore(1, ErrNotFound)
+			s = NewRetryStore(st)
+			s.SetBackoff(time.Millisecond, time.Millisecond)
+			s.SetRetryable(func(err error) bool { return true })
+			_, err = s.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(2)))
+		})
+
+		It("should stop retrying once the context is done", func() {
+			st, calls := failingStore(5, errors.New("test error"))
+			s := NewRetryStore(st)
+			s.SetBackoff(time.Hour, time.Hour)
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(10*time.Millisecond, cancel)
+			_, err := s.GetContext(ctx, []byte("key"))
+			Ω(err).Should(Equal(context.Canceled))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(1)))
+
+			ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			start := time.Now()
+			_, err = s.GetContext(ctx, []byte("key"))
+			Ω(err).Should(MatchError("test error"))
+			Ω(time.Since(start)).Should(BeNumerically("<", time.Second))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(2)))
+		})
+	})
+
+	Context("optional interfaces", func() {
+
+		It("should provide and retry the wrapped store's interfaces", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			s := NewRetryStore(ws)
+			s.SetBackoff(time.Millisecond, time.Millisecond)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeTrue())
+			_, ok = streamStore(s)
+			Ω(ok).Should(BeFalse())
+			err := s.Put([]byte("key"), []byte("value"))
+			Ω(err).Should(MatchError("test error"))
+			Ω(s.StoreStats().Retries).Should(Equal(int64(2)))
+
+			ws.setFail(false)
+			l := NewLRU("", "", DefaultTwoQ(0), s)
+			err = l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.Set([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("key")).Should(Equal([]byte("value")))
+			err = l.Unset([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("key")).Should(BeNil())
+		})
+
+		It("should not provide interfaces the wrapped store lacks", func() {
+			st, calls := failingStore(0, nil)
+			s := NewRetryStore(st)
+			_, ok := writableStore(s)
+			Ω(ok).Should(BeFalse())
+			err := s.Put([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			Ω(s.StoreStats().Retries).Should(Equal(int64(0)))
+
+			// other retrievals fall back to the wrapped store's Get
+			vals, errs := s.GetMulti([][]byte{[]byte("a"), []byte("b")})
+			Ω(errs).Should(Equal([]error{nil, nil}))
+			Ω(vals).Should(Equal([][]byte{[]byte("value"), []byte("value")}))
+			v, err := s.GetRange([]byte("key"), 1, 3)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("alu")))
+			Ω(atomic.LoadInt32(calls)).Should(Equal(int32(3)))
+
+			l := NewLRU("", "", DefaultTwoQ(0), s)
+			err = l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.Set([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+		})
+	})
+
+	Context("backoff", func() {
+
+		It("should double the delay up to the maximum, with jitter", func() {
+			s := NewRetryStore(nil)
+			s.SetBackoff(10*time.Millisecond, 50*time.Millisecond)
+			s.SetJitter(0)
+			Ω(s.backoff(1)).Should(Equal(10 * time.Millisecond))
+			Ω(s.backoff(2)).Should(Equal(20 * time.Millisecond))
+			Ω(s.backoff(3)).Should(Equal(40 * time.Millisecond))
+			Ω(s.backoff(4)).Should(Equal(50 * time.Millisecond))
+			s.SetJitter(0.5)
+			for i := 0; i < 100; i++ {
+				Ω(s.backoff(1)).Should(BeNumerically("~", 7500*time.Microsecond, 2500*time.Microsecond))
+			}
+		})
+	})
+
+	Context("Stats", func() {
+
+		It("should include the retries in the LRU's stats", func() {
+			st, _ := failingStore(1, errors.New("test error"))
+			rs := NewRetryStore(st)
+			rs.SetBackoff(time.Millisecond, time.Millisecond)
+			l := NewLRU("", "", DefaultTwoQ(0), NewChainStore(rs))
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			_, err = l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			s := l.ResetStats()
+			Ω(s.Store.Retries).Should(Equal(int64(1)))
+			Ω(s.Store.TierHits).Should(Equal([]int64{1}))
+			Ω(l.Stats().Store.Retries).Should(Equal(int64(0)))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package lru
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/boltdb/bolt"
+)
+
+// stateVersion is the version of the encoding used by encodeState.
+const stateVersion = 1
+
+// stateKey is the key of the algorithm's checkpoint in the state bucket.
+var stateKey = []byte("state")
+
+// ErrInvalidState is returned by UnmarshalState if the provided state is
+// invalid.
+var ErrInvalidState = errors.New("invalid algorithm state")
+
+// saveState checkpoints the state of the LRU's algorithm into the state bucket,
+// replacing the existing checkpoint, and returns any error encountered. Nothing
+// is checkpointed if the LRU's algorithm isn't a StatefulAlgorithm. The items
+// of the package's algorithms are only walked while the LRU is locked, and
+// encoded once it is unlocked.
+func (l *LRU) saveState() error {
+	sa, ok := l.lru.(StatefulAlgorithm)
+	if !ok {
+		return nil
+	}
+	var state []byte
+	var err error
+	l.mu.Lock()
+	if ra, ok := l.lru.(recencyAlgorithm); ok {
+		items := walkRecency(ra)
+		l.mu.Unlock()
+		state = encodeState(items)
+	} else {
+		state, err = sa.MarshalState()
+		l.mu.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	return l.db.Update(func(tx *bolt.Tx) error {
+		sb, err := tx.CreateBucketIfNotExists(l.sName)
+		if err != nil {
+			return err
+		}
+		return sb.Put(stateKey, state)
+	})
+}
+
+// stateItem represents a single item of an algorithm's serialized state.
+type stateItem struct {
+	key    []byte // the item's key
+	size   int64  // size of the item's value in bytes
+	status uint8  // the item's status (i.e. hot, warm, cold)
+}
+
+// encodeState encodes the provided items, which should be ordered from the
+// most to the least recently used. Each item is encoded as its status, the
+// uvarint length of its key, its key and the uvarint size of its value.
+func encodeState(items []stateItem) []byte {
+	n := 1
+	for _, i := range items {
+		n += 1 + 2*binary.MaxVarintLen64 + len(i.key)
+	}
+	b := make([]byte, 1, n)
+	b[0] = stateVersion
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, i := range items {
+		b = append(b, i.status)
+		b = append(b, tmp[:binary.PutUvarint(tmp, uint64(len(i.key)))]...)
+		b = append(b, i.key...)
+		b = append(b, tmp[:binary.PutUvarint(tmp, uint64(i.size))]...)
+	}
+	return b
+}
+
+// decodeState decodes the items encoded by encodeState. The keys are copied,
+// so the provided bytes may be reused. ErrInvalidState is returned if the
+// encoding is invalid or contains a key more than once.
+func decodeState(b []byte) ([]stateItem, error) {
+	if len(b) == 0 || b[0] != stateVersion {
+		return nil, ErrInvalidState
+	}
+	b = b[1:]
+	var items []stateItem
+	seen := make(map[string]struct{})
+	for len(b) > 0 {
+		status := b[0]
+		if status > twoQCold {
+			return nil, ErrInvalidState
+		}
+		klen, n := binary.Uvarint(b[1:])
+		if n <= 0 || klen > uint64(len(b)-1-n) {
+			return nil, ErrInvalidState
+		}
+		b = b[1+n:]
+		key := make([]byte, klen)
+		copy(key, b)
+		b = b[klen:]
+		size, n := binary.Uvarint(b)
+		if n <= 0 || int64(size) < 0 {
+			return nil, ErrInvalidState
+		}
+		b = b[n:]
+		if _, ok := seen[string(key)]; ok {
+			return nil, ErrInvalidState
+		}
+		seen[string(key)] = struct{}{}
+		items = append(items, stateItem{key: key, size: int64(size), status: status})
+	}
+	return items, nil
+}
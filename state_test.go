@@ -0,0 +1,82 @@
+package lru
+
+import (
+	"strconv"
+
+	"github.com/boltdb/bolt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State", func() {
+
+	Context("saveState", func() {
+
+		It("should add values missing from the checkpoint when reopened", func() {
+			l := newDefaultLRU()
+			err := l.put([]byte("0"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			state, err := l.lru.(StatefulAlgorithm).MarshalState()
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.put([]byte("1"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			// simulate a crash after the first checkpoint
+			writeState(state)
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			Ω(l.lru.Len()).Should(Equal(int64(2)))
+			Ω(l.lru.Peek([]byte("1"))).Should(Equal(int64(5)))
+		})
+
+		It("should remove checkpointed items missing from the database when reopened", func() {
+			l := newDefaultLRU()
+			for i := 0; i < 2; i++ {
+				err := l.put([]byte(strconv.Itoa(i)), []byte("value"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			state, err := l.lru.(StatefulAlgorithm).MarshalState()
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Delete([]byte("1"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			// simulate a crash after the first checkpoint
+			writeState(state)
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			Ω(l.lru.Len()).Should(Equal(int64(1)))
+			Ω(l.lru.Peek([]byte("1"))).Should(Equal(int64(-1)))
+		})
+
+		It("should ignore an invalid checkpoint", func() {
+			l := newDefaultLRU()
+			err := l.put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			writeState([]byte("bad"))
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			Ω(l.lru.Len()).Should(Equal(int64(1)))
+			Ω(l.lru.Peek([]byte("key"))).Should(Equal(int64(5)))
+		})
+	})
+})
+
+// writeState replaces the checkpoint of the default LRU's closed database.
+func writeState(state []byte) {
+	l := NewLRU("", "", DefaultTwoQ(0), nil)
+	db, err := bolt.Open(l.dbPath, 0666, nil)
+	Ω(err).ShouldNot(HaveOccurred())
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(l.sName).Put(stateKey, state)
+	})
+	Ω(err).ShouldNot(HaveOccurred())
+}
@@ -9,38 +9,109 @@ type Stats struct {
 	StartTime    time.Time     `json:"start_time"`
 	Uptime       time.Duration `json:"uptime"`
 	Hits         int64         `json:"hits"`
+	StaleHits    int64         `json:"stale_hits"`
 	Misses       int64         `json:"misses"`
+	NegativeHits int64         `json:"negative_hits"`
 	GetBytes     int64         `json:"get_bytes"`
 	Puts         int64         `json:"puts"`
 	PutBytes     int64         `json:"put_bytes"`
 	Evicted      int64         `json:"evicted"`
 	EvictedBytes int64         `json:"evicted_bytes"`
+	Deleted      int64         `json:"deleted"`
+	DeletedBytes int64         `json:"deleted_bytes"`
+	Expired      int64         `json:"expired"`
 	Size         int64         `json:"size"`
 	Capacity     int64         `json:"capacity"`
 	NumItems     int64         `json:"num_items"`
+	JournalDepth int64         `json:"journal_depth"`
+	JournalAge   time.Duration `json:"journal_age"`
+	JournalFails int64         `json:"journal_fails"`
+	JournalDrops int64         `json:"journal_drops"`
+	Store        StoreStats    `json:"store"`
 }
 
-// Stats returns the current stats for the given LRU.
+// StoreStats contains a number of stats pertaining to an LRU's remote store, as
+// reported by a StatsStore.
+type StoreStats struct {
+	TierHits       []int64 `json:"tier_hits,omitempty"`
+	Retries        int64   `json:"retries"`
+	BreakerState   string  `json:"breaker_state,omitempty"`
+	BreakerTrips   int64   `json:"breaker_trips"`
+	BreakerRejects int64   `json:"breaker_rejects"`
+	LimitQueued    int64   `json:"limit_queued"`
+	LimitRejected  int64   `json:"limit_rejected"`
+	Hedges         int64   `json:"hedges"`
+	HedgeWins      int64   `json:"hedge_wins"`
+}
+
+// add adds the provided store stats, other than TierHits, to the store stats.
+// BreakerState is only set if it is empty.
+func (s *StoreStats) add(o StoreStats) {
+	s.Retries += o.Retries
+	if s.BreakerState == "" {
+		s.BreakerState = o.BreakerState
+	}
+	s.BreakerTrips += o.BreakerTrips
+	s.BreakerRejects += o.BreakerRejects
+	s.LimitQueued += o.LimitQueued
+	s.LimitRejected += o.LimitRejected
+	s.Hedges += o.Hedges
+	s.HedgeWins += o.HedgeWins
+}
+
+// storeStats returns the stats of the provided store if it is a StatsStore, and
+// resets them if reset is true.
+func storeStats(st Store, reset bool) StoreStats {
+	ss, ok := st.(StatsStore)
+	if !ok {
+		return StoreStats{}
+	}
+	if reset {
+		return ss.ResetStoreStats()
+	}
+	return ss.StoreStats()
+}
+
+// Stats returns the current stats for the given LRU. JournalDepth is the number
+// of remote store writes queued by WriteBack mode that have yet to be flushed,
+// and JournalAge is the time elapsed since the oldest of them was queued.
+// JournalFails is the number of consecutive failed attempts to flush the oldest
+// of them, and JournalDrops the number of writes dropped from the journal
+// without being written into the remote store.
+// Store holds the stats of the LRU's remote store, if it is a StatsStore.
 func (l *LRU) Stats() Stats {
+	depth, age := l.journalStats()
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.getStats()
+	stats := l.getStats()
+	stats.JournalDepth, stats.JournalAge = depth, age
+	stats.Store = storeStats(l.store, false)
+	return stats
 }
 
 // ResetStats resets all stats to their initial state and returns the LRU's
 // stats as they were immediately before being reset.
 func (l *LRU) ResetStats() Stats {
 	var stats Stats
+	depth, age := l.journalStats()
 	l.mu.Lock()
 	stats = l.getStats()
+	stats.JournalDepth, stats.JournalAge = depth, age
+	stats.Store = storeStats(l.store, true)
 	l.sTime = time.Now().UTC()
 	l.hits = 0
+	l.staleHits = 0
 	l.misses = 0
+	l.negHits = 0
 	l.bget = 0
 	l.puts = 0
 	l.bput = 0
 	l.evicted = 0
 	l.bevicted = 0
+	l.deleted = 0
+	l.bdeleted = 0
+	l.expired = 0
+	l.jdropped = 0
 	l.mu.Unlock()
 	return stats
 }
@@ -52,14 +123,21 @@ func (l *LRU) getStats() Stats {
 		StartTime:    l.sTime,
 		Uptime:       time.Since(l.sTime),
 		Hits:         l.hits,
+		StaleHits:    l.staleHits,
 		Misses:       l.misses,
+		NegativeHits: l.negHits,
 		GetBytes:     l.bget,
 		Puts:         l.puts,
 		PutBytes:     l.bput,
 		Evicted:      l.evicted,
 		EvictedBytes: l.bevicted,
+		Deleted:      l.deleted,
+		DeletedBytes: l.bdeleted,
+		Expired:      l.expired,
 		Size:         l.lru.Size(),
 		Capacity:     l.lru.Cap(),
 		NumItems:     l.lru.Len(),
+		JournalFails: l.jfails,
+		JournalDrops: l.jdropped,
 	}
 }
@@ -27,12 +27,17 @@ var _ = Describe("Stats", func() {
 			Ω(s.StartTime.IsZero()).Should(BeFalse())
 			Ω(s.Uptime).Should(BeNumerically(">", 0))
 			Ω(s.Hits).Should(Equal(int64(0)))
+			Ω(s.StaleHits).Should(Equal(int64(0)))
 			Ω(s.Misses).Should(Equal(int64(0)))
+			Ω(s.NegativeHits).Should(Equal(int64(0)))
 			Ω(s.GetBytes).Should(Equal(int64(0)))
 			Ω(s.Puts).Should(Equal(int64(0)))
 			Ω(s.PutBytes).Should(Equal(int64(0)))
 			Ω(s.Evicted).Should(Equal(int64(0)))
 			Ω(s.EvictedBytes).Should(Equal(int64(0)))
+			Ω(s.Deleted).Should(Equal(int64(0)))
+			Ω(s.DeletedBytes).Should(Equal(int64(0)))
+			Ω(s.Expired).Should(Equal(int64(0)))
 			Ω(s.Size).Should(Equal(int64(600)))
 			Ω(s.Capacity).Should(Equal(int64(1000)))
 			Ω(s.NumItems).Should(Equal(int64(2)))
@@ -44,24 +49,34 @@ func setTestStats(l *LRU) {
 	l.lru.PutOnStartup([]byte("1"), 400)
 	l.lru.PutOnStartup([]byte("2"), 200)
 	l.hits = 1
+	l.staleHits = 11
 	l.misses = 2
+	l.negHits = 12
 	l.bget = 3
 	l.puts = 4
 	l.bput = 5
 	l.evicted = 6
 	l.bevicted = 7
+	l.deleted = 8
+	l.bdeleted = 9
+	l.expired = 10
 }
 
 func verifyTestStats(s Stats) {
 	Ω(s.StartTime.IsZero()).Should(BeFalse())
 	Ω(s.Uptime).Should(BeNumerically(">", 0))
 	Ω(s.Hits).Should(Equal(int64(1)))
+	Ω(s.StaleHits).Should(Equal(int64(11)))
 	Ω(s.Misses).Should(Equal(int64(2)))
+	Ω(s.NegativeHits).Should(Equal(int64(12)))
 	Ω(s.GetBytes).Should(Equal(int64(3)))
 	Ω(s.Puts).Should(Equal(int64(4)))
 	Ω(s.PutBytes).Should(Equal(int64(5)))
 	Ω(s.Evicted).Should(Equal(int64(6)))
 	Ω(s.EvictedBytes).Should(Equal(int64(7)))
+	Ω(s.Deleted).Should(Equal(int64(8)))
+	Ω(s.DeletedBytes).Should(Equal(int64(9)))
+	Ω(s.Expired).Should(Equal(int64(10)))
 	Ω(s.Size).Should(Equal(int64(600)))
 	Ω(s.Capacity).Should(Equal(int64(1000)))
 	Ω(s.NumItems).Should(Equal(int64(2)))
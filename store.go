@@ -1,7 +1,13 @@
 package lru
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
 )
 
 // Store is an interface representing a remote data store.
@@ -11,6 +17,271 @@ type Store interface {
 	Close() error               // close the store
 }
 
+// ContextStore is a Store whose retrievals can be cancelled. If an LRU's store
+// implements ContextStore, its GetContext method is called in place of Get with
+// a context that is cancelled once no caller is waiting for the result.
+type ContextStore interface {
+	Store
+	GetContext(context.Context, []byte) ([]byte, error)
+}
+
+// BatchStore is a Store able to retrieve multiple values in a single call. If
+// an LRU's store implements BatchStore, its GetMulti method is used to retrieve
+// all values missing from the cache during a call to the LRU's GetMulti. The
+// returned slices must have the same length as the provided keys, with each
+// index holding either the value or the error for the corresponding key.
+type BatchStore interface {
+	Store
+	GetMulti([][]byte) ([][]byte, []error)
+}
+
+// RangeStore is a Store able to retrieve part of a value. If an LRU's store
+// implements RangeStore, its GetRange method is used to satisfy a call to the
+// LRU's GetRange for a value missing from the cache, while the complete value
+// is retrieved in the background. GetRange should return up to length bytes
+// of the value starting at the provided offset, or all of the bytes following
+// the offset if length is negative.
+type RangeStore interface {
+	Store
+	GetRange(key []byte, offset, length int64) ([]byte, error)
+}
+
+// StreamStore is a Store able to stream a value. If an LRU's store implements
+// StreamStore, its GetStream method is used to retrieve a value missing from
+// the cache during a call to the LRU's GetReader. GetStream should return the
+// value's stream and its size in bytes, or -1 if the size is unknown. The
+// stream is closed once fully read, or early if the request is abandoned.
+type StreamStore interface {
+	Store
+	GetStream([]byte) (io.ReadCloser, int64, error)
+}
+
+// WritableStore is a Store whose values can be written. An LRU's Set and Unset
+// methods require its store to implement WritableStore. Delete should succeed
+// if no value exists for the provided key.
+type WritableStore interface {
+	Store
+	Put(key, val []byte) error
+	Delete(key []byte) error
+}
+
+// StatsStore is a Store that keeps its own stats. If an LRU's store implements
+// StatsStore, its stats are included in the LRU's Stats, and reset along with
+// them.
+type StatsStore interface {
+	Store
+	StoreStats() StoreStats      // return the store's current stats
+	ResetStoreStats() StoreStats // reset the stats, returning the previous
+}
+
+// storeGet retrieves the value with the provided key from the provided store,
+// using its GetContext method if it is a ContextStore.
+func storeGet(ctx context.Context, s Store, key []byte) ([]byte, error) {
+	if cs, ok := s.(ContextStore); ok {
+		return cs.GetContext(ctx, key)
+	}
+	return s.Get(key)
+}
+
+// storeGetMulti retrieves the values with the provided keys from the provided
+// store, using its GetMulti method if it is a BatchStore, or its Get method for
+// each key otherwise.
+func storeGetMulti(s Store, keys [][]byte) ([][]byte, []error) {
+	if bs, ok := s.(BatchStore); ok {
+		return bs.GetMulti(keys)
+	}
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		vals[i], errs[i] = s.Get(key)
+	}
+	return vals, errs
+}
+
+// storeGetRange retrieves the provided range of the value with the provided key
+// from the provided store, using its GetRange method if it is a RangeStore, or
+// slicing the value retrieved with its Get method otherwise.
+func storeGetRange(s Store, key []byte, offset, length int64) ([]byte, error) {
+	if rs, ok := s.(RangeStore); ok {
+		return rs.GetRange(key, offset, length)
+	}
+	v, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return sliceRange(v, offset, length)
+}
+
+// storeGetStream streams the value with the provided key from the provided
+// store, using its GetStream method if it is a StreamStore, or streaming the
+// value retrieved with its Get method otherwise.
+func storeGetStream(s Store, key []byte) (io.ReadCloser, int64, error) {
+	if ss, ok := s.(StreamStore); ok {
+		return ss.GetStream(key)
+	}
+	v, err := s.Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(v)), int64(len(v)), nil
+}
+
+// storePut writes the provided key and value into the provided store, or
+// returns ErrNotWritable if it isn't a WritableStore.
+func storePut(s Store, key, val []byte) error {
+	ws, ok := s.(WritableStore)
+	if !ok {
+		return ErrNotWritable
+	}
+	return ws.Put(key, val)
+}
+
+// storeDelete deletes the provided key from the provided store, or returns
+// ErrNotWritable if it isn't a WritableStore.
+func storeDelete(s Store, key []byte) error {
+	ws, ok := s.(WritableStore)
+	if !ok {
+		return ErrNotWritable
+	}
+	return ws.Delete(key)
+}
+
+// batchErr returns the first of the provided errors of a batch retrieval that
+// isn't a not found error, or nil if there is none.
+func batchErr(errs []error) error {
+	for _, err := range errs {
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapperStore is implemented by the package's stores wrapping another Store,
+// such as a RetryStore. A wrapper has the methods of all optional interfaces,
+// and forwards them to the store it wraps, but only provides an LRU with the
+// optional interfaces the wrapped store implements.
+type wrapperStore interface {
+	Store
+	wrapped() Store
+}
+
+// implements returns true if the provided store implements the optional
+// interface checked by the provided function. A wrapperStore implements it
+// only if the store it wraps does as well.
+func implements(s Store, is func(Store) bool) bool {
+	for is(s) {
+		w, ok := s.(wrapperStore)
+		if !ok {
+			return true
+		}
+		s = w.wrapped()
+	}
+	return false
+}
+
+// batchStore returns the provided store as a BatchStore, if it is one.
+func batchStore(s Store) (BatchStore, bool) {
+	bs, ok := s.(BatchStore)
+	return bs, ok && implements(s, func(s Store) bool {
+		_, ok := s.(BatchStore)
+		return ok
+	})
+}
+
+// rangeStore returns the provided store as a RangeStore, if it is one.
+func rangeStore(s Store) (RangeStore, bool) {
+	rs, ok := s.(RangeStore)
+	return rs, ok && implements(s, func(s Store) bool {
+		_, ok := s.(RangeStore)
+		return ok
+	})
+}
+
+// streamStore returns the provided store as a StreamStore, if it is one.
+func streamStore(s Store) (StreamStore, bool) {
+	ss, ok := s.(StreamStore)
+	return ss, ok && implements(s, func(s Store) bool {
+		_, ok := s.(StreamStore)
+		return ok
+	})
+}
+
+// writableStore returns the provided store as a WritableStore, if it is one.
+func writableStore(s Store) (WritableStore, bool) {
+	ws, ok := s.(WritableStore)
+	return ws, ok && implements(s, func(s Store) bool {
+		_, ok := s.(WritableStore)
+		return ok
+	})
+}
+
+// storeHintsKey is the context key of the hints of a retrieval made by an LRU.
+type storeHintsKey struct{}
+
+// storeHints holds the hints exchanged between an LRU and its store during a
+// retrieval.
+type storeHints struct {
+	mu     sync.Mutex
+	ttl    time.Duration // TTL of the retrieved value, set by the store
+	ttlSet bool          // whether the TTL was set
+	stale  func() []byte // returns the stale value being retrieved again, if any
+}
+
+// valueTTL returns the TTL set by the store, and whether it was set.
+func (h *storeHints) valueTTL() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ttl, h.ttlSet
+}
+
+// SetValueTTL sets the time-to-live with which the value being retrieved is
+// cached, in place of the LRU's default TTL. It only has an effect when called
+// by a ContextStore's GetContext method with the context it received from an
+// LRU, including through the stores wrapping it. A TTL that is not positive
+// disables the value's expiration.
+func SetValueTTL(ctx context.Context, ttl time.Duration) {
+	if h, ok := ctx.Value(storeHintsKey{}).(*storeHints); ok {
+		h.mu.Lock()
+		h.ttl, h.ttlSet = ttl, true
+		h.mu.Unlock()
+	}
+}
+
+// StaleValue returns the stale value cached for the key being retrieved, so
+// that the store may revalidate it rather than transfer it again, or nil if
+// there is none. This is the value an LRU refreshes in the background, or the
+// expired value it still holds when the key is requested again after the stale
+// grace period. As with SetValueTTL, the provided context must be the one a
+// ContextStore received from an LRU.
+func StaleValue(ctx context.Context) []byte {
+	if h, ok := ctx.Value(storeHintsKey{}).(*storeHints); ok && h.stale != nil {
+		return h.stale()
+	}
+	return nil
+}
+
+// ErrNotFound is the error a Store should return when no value exists for the
+// requested key.
+var ErrNotFound = errors.New("no value found in the store")
+
+// IsNotFound returns true if the provided error, as returned by a Store,
+// indicates that no value exists for the requested key. This is the case for
+// ErrNotFound, ErrNoValue, and any error with a NotFound method returning true.
+func IsNotFound(err error) bool {
+	if err == ErrNotFound || err == ErrNoValue {
+		return true
+	}
+	nf, ok := err.(interface {
+		NotFound() bool
+	})
+	return ok && nf.NotFound()
+}
+
+// ErrNotWritable is the error returned when writing into a remote store that
+// isn't a WritableStore.
+var ErrNotWritable = errors.New("remote store isn't writable")
+
 // errNoStore is the error returned by a "noStore" store if the Get method is
 // called on it.
 var errNoStore = errors.New("no remote store available")
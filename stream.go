@@ -0,0 +1,521 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// streamChunkSize is the size of the chunks in which values streamed from a
+// StreamStore are staged in the bolt database.
+const streamChunkSize = 256 << 10
+
+var (
+	// errChunkMissing is the error returned when reading a staged chunk of
+	// a stream that no longer exists in the bolt database.
+	errChunkMissing = errors.New("stream chunk missing from the database")
+	// errNegativeOffset is the error returned when reading from or seeking
+	// to a negative offset of a stream.
+	errNegativeOffset = errors.New("negative offset")
+	// errInvalidWhence is the error returned when seeking with an invalid
+	// whence.
+	errInvalidWhence = errors.New("invalid whence")
+)
+
+// stream represents a value being streamed from a StreamStore. The value is
+// staged in the bolt database in chunks of streamChunkSize bytes as it is
+// received, from which all readers of the stream read. The staged chunks are
+// laid out as those of a chunked value, within a nested bucket of the staging
+// bucket, and are promoted into the cache once the stream completes.
+type stream struct {
+	id      uint64        // the stream's unique ID in the staging bucket
+	opened  chan struct{} // closed once the stream is opened or has failed
+	size    int64         // size announced by the store, set once opened
+	mu      sync.Mutex    // mutex protecting everything below
+	cond    *sync.Cond    // signalled when chunks are staged or when done
+	n       int64         // # of bytes staged
+	done    bool          // whether the stream is complete
+	err     error         // error encountered while streaming
+	refs    int           // # of readers, plus one for the retrieval
+	release func()        // deletes the staged chunks once unreferenced
+}
+
+// newStream returns a new stream with the next stream ID.
+// Note: this method should only be called when the muReqs mutex is locked!
+func (l *LRU) newStream() *stream {
+	s := &stream{
+		id:     l.nextID,
+		opened: make(chan struct{}),
+		size:   -1,
+		refs:   1,
+	}
+	l.nextID++
+	s.cond = sync.NewCond(&s.mu)
+	s.release = func() {
+		_ = l.deleteStreamFromBolt(s.id)
+	}
+	return s
+}
+
+// open registers that the stream was opened with the provided size.
+func (s *stream) open(size int64) {
+	s.size = size
+	close(s.opened)
+}
+
+// stage registers that the provided number of bytes have been staged.
+func (s *stream) stage(n int64) {
+	s.mu.Lock()
+	s.n += n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// finish registers that the stream is complete with the provided error. Only
+// the first call has any effect.
+func (s *stream) finish(err error) {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done, s.err = true, err
+	select {
+	case <-s.opened:
+	default:
+		close(s.opened)
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// wait waits until more than the provided number of bytes have been staged or
+// the stream is complete, and returns the number of bytes staged and the
+// stream's error, if complete.
+func (s *stream) wait(off int64) (int64, error) {
+	s.mu.Lock()
+	for s.n <= off && !s.done {
+		s.cond.Wait()
+	}
+	n, err := s.n, s.err
+	if s.n <= off && err == nil {
+		err = io.EOF
+	}
+	s.mu.Unlock()
+	return n, err
+}
+
+// ref adds a reference to the stream.
+// Note: this method should only be called when the muReqs mutex is locked!
+func (s *stream) ref() {
+	s.mu.Lock()
+	s.refs++
+	s.mu.Unlock()
+}
+
+// unref removes a reference to the stream, deleting its staged chunks once it
+// is no longer referenced.
+func (s *stream) unref() {
+	s.mu.Lock()
+	s.refs--
+	refs := s.refs
+	s.mu.Unlock()
+	if refs == 0 {
+		s.release()
+	}
+}
+
+// loadStream retrieves a Reader streaming the value for the provided key from
+// the provided StreamStore, sharing any request already in progress for the
+// same key. It waits until the stream is opened or the provided context is
+// done.
+func (l *LRU) loadStream(ctx context.Context, key []byte, ss StreamStore) (*Reader, error) {
+
+	// register request
+	ttl := l.defaultTTL()
+	l.muReqs.Lock()
+	r, ok := l.reqs[string(key)]
+	if !ok {
+		k := make([]byte, len(key))
+		copy(k, key)
+		r = newReq(ttl)
+		r.s = l.newStream()
+		l.reqs[string(k)] = r
+		go l.fetchStream(k, r, ss)
+	}
+	r.waiters++
+	if r.s != nil {
+		r.s.ref()
+	}
+	l.muReqs.Unlock()
+
+	// the request isn't streamed, wait for its value
+	if r.s == nil {
+		if err := l.wait(ctx, key, r, r.done); err != nil {
+			return nil, err
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		return newReader(nil, r.value), nil
+	}
+
+	// wait for the stream to be opened
+	if err := l.wait(ctx, key, r, r.s.opened); err != nil {
+		r.s.unref()
+		return nil, err
+	}
+	r.s.mu.Lock()
+	err := r.s.err
+	r.s.mu.Unlock()
+	if err != nil {
+		l.abandon(key, r)
+		r.s.unref()
+		return nil, err
+	}
+	k := make([]byte, len(key))
+	copy(k, key)
+	return &Reader{r: &streamReader{l: l, key: k, r: r, s: r.s}}, nil
+}
+
+// fetchStream retrieves the value for the provided key from the provided
+// StreamStore as the provided registered request. Once the stream completes,
+// its staged chunks are promoted into the cache.
+func (l *LRU) fetchStream(key []byte, r *req, ss StreamStore) {
+	err := l.getStreamRes(r.ctx, key, r.s, ss)
+	r.s.finish(err)
+	r.complete(nil, err)
+	if err == nil {
+		l.putStreamReq(key, r)
+	}
+	l.deleteReq(key, r)
+	r.s.unref()
+}
+
+// getStreamRes stages the stream of the value for the provided key as
+// stageStream does. If the StreamStore panics, the panic is recovered and an
+// error is returned.
+func (l *LRU) getStreamRes(ctx context.Context, key []byte, s *stream, ss StreamStore) (err error) {
+	// recover from a panic by returning an error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return l.stageStream(ctx, key, s, ss)
+}
+
+// putStreamReq promotes the staged chunks of the provided streamed request
+// into the cache with the provided key, unless the request has been cancelled.
+func (l *LRU) putStreamReq(key []byte, r *req) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancelled {
+		return nil
+	}
+	r.s.mu.Lock()
+	n := r.s.n
+	r.s.mu.Unlock()
+	exp := expiryFromTTL(r.ttl)
+	if err := l.promoteStreamIntoBolt(key, r.s.id, n, exp); err != nil {
+		return err
+	}
+	l.addItem(key, n, exp)
+	return nil
+}
+
+// reqValue returns the value of the provided completed request, or its
+// error. The value of a streamed request is assembled from its staged chunks,
+// so the caller must hold a reference to the stream.
+func (l *LRU) reqValue(r *req) ([]byte, error) {
+	if r.s == nil || r.err != nil {
+		return r.value, r.err
+	}
+	r.s.mu.Lock()
+	n := r.s.n
+	r.s.mu.Unlock()
+	return l.getStreamFromBolt(r.s.id, n)
+}
+
+// stageStream opens the stream of the value for the provided key from the
+// provided StreamStore, unless the key is in the negative cache, and stages it
+// into the bolt database chunk by chunk. The stream is closed early once the
+// provided context is done.
+func (l *LRU) stageStream(ctx context.Context, key []byte, s *stream, ss StreamStore) error {
+	// return the cached error if the store recently reported that no value
+	// exists
+	if err := l.getNegative(key); err != nil {
+		return err
+	}
+	rc, size, err := ss.GetStream(key)
+	if err == nil && rc == nil {
+		err = ErrNoValue
+	}
+	l.putNegative(key, err)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	s.open(size)
+
+	// close the stream once the request is abandoned
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+		case <-stopped:
+		}
+	}()
+
+	// stage the stream chunk by chunk
+	var n int64
+	chunk := make([]byte, streamChunkSize)
+	for idx := uint64(0); ; idx++ {
+		m, err := io.ReadFull(rc, chunk)
+		if m > 0 {
+			if err := l.putStreamIntoBolt(s.id, idx, chunk[:m]); err != nil {
+				return err
+			}
+			n += int64(m)
+			s.stage(int64(m))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+	// the stream may have ended early after being closed
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if size >= 0 && n != size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// streamReader reads a value from a stream as it is staged in the bolt
+// database.
+type streamReader struct {
+	l   *LRU
+	key []byte
+	r   *req
+	s   *stream
+	off int64
+}
+
+// Read reads up to len(p) bytes of the value into p, waiting for them to be
+// staged if necessary.
+func (sr *streamReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := sr.readAt(p, sr.off)
+	sr.off += int64(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes of the value into p starting at the provided
+// offset, waiting for them to be staged if necessary.
+func (sr *streamReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	var n int
+	for n < len(p) {
+		m, err := sr.readAt(p[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readAt reads up to len(p) bytes of the value from a single chunk into p
+// starting at the provided offset. Chunks are only staged once complete.
+func (sr *streamReader) readAt(p []byte, off int64) (int, error) {
+	staged, err := sr.s.wait(off)
+	if off >= staged {
+		return 0, err
+	}
+	var n int
+	err = sr.l.viewStreamChunk(sr.s.id, off, func(chunk []byte) error {
+		n = copy(p, chunk[off%streamChunkSize:])
+		return nil
+	})
+	return n, err
+}
+
+// Seek sets the offset for the next Read according to whence, as defined by
+// io.Seeker. Seeking relative to the end of a value of unknown size waits for
+// the stream to complete.
+func (sr *streamReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sr.off
+	case io.SeekEnd:
+		size := sr.s.size
+		if size < 0 {
+			var err error
+			if size, err = sr.s.wait(1<<63 - 1); err != io.EOF {
+				return 0, err
+			}
+		}
+		offset += size
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	sr.off = offset
+	return offset, nil
+}
+
+// WriteTo writes the remainder of the value to the provided io.Writer directly
+// from the staged chunks, waiting for them to be staged if necessary.
+func (sr *streamReader) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for {
+		staged, err := sr.s.wait(sr.off)
+		if sr.off >= staged {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		var m int
+		err = sr.l.viewStreamChunk(sr.s.id, sr.off, func(chunk []byte) error {
+			var err error
+			m, err = w.Write(chunk[sr.off%streamChunkSize:])
+			return err
+		})
+		sr.off += int64(m)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Size returns the size of the value announced by the store, or the number of
+// bytes streamed if it was unknown and the stream is complete. Otherwise, -1 is
+// returned.
+func (sr *streamReader) Size() int64 {
+	if sr.s.size >= 0 {
+		return sr.s.size
+	}
+	sr.s.mu.Lock()
+	defer sr.s.mu.Unlock()
+	if sr.s.done && sr.s.err == nil {
+		return sr.s.n
+	}
+	return -1
+}
+
+// Close releases the reader's share of the stream. Once no caller is reading
+// or waiting for the stream anymore, an incomplete stream is closed early.
+func (sr *streamReader) Close() error {
+	sr.l.abandon(sr.key, sr.r)
+	sr.s.unref()
+	return nil
+}
+
+// streamKey returns the key of the nested bucket of the stream with the
+// provided ID in the staging bucket.
+func streamKey(id uint64) []byte {
+	return chunkKey(id)
+}
+
+// putStreamIntoBolt stages the provided chunk with the provided index of the
+// stream with the provided ID.
+func (l *LRU) putStreamIntoBolt(id, idx uint64, chunk []byte) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		sb, err := tx.Bucket(l.pName).CreateBucketIfNotExists(streamKey(id))
+		if err != nil {
+			return err
+		}
+		return sb.Put(chunkKey(idx), chunk)
+	})
+}
+
+// viewStreamChunk calls the provided function with the staged chunk containing
+// the provided offset of the stream with the provided ID. The chunk is only
+// valid during the call.
+func (l *LRU) viewStreamChunk(id uint64, off int64, fn func([]byte) error) error {
+	return l.db.View(func(tx *bolt.Tx) error {
+		var chunk []byte
+		if sb := tx.Bucket(l.pName).Bucket(streamKey(id)); sb != nil {
+			chunk = sb.Get(chunkKey(uint64(off / streamChunkSize)))
+		}
+		if int64(len(chunk)) <= off%streamChunkSize {
+			return errChunkMissing
+		}
+		return fn(chunk)
+	})
+}
+
+// getStreamFromBolt returns the value assembled from the provided number of
+// bytes staged for the stream with the provided ID.
+func (l *LRU) getStreamFromBolt(id uint64, n int64) ([]byte, error) {
+	val := make([]byte, 0, n)
+	err := l.db.View(func(tx *bolt.Tx) error {
+		sb := tx.Bucket(l.pName).Bucket(streamKey(id))
+		for idx := uint64(0); sb != nil && int64(len(val)) < n; idx++ {
+			chunk := sb.Get(chunkKey(idx))
+			if len(chunk) == 0 {
+				break
+			}
+			val = append(val, chunk...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(val)) != n {
+		return nil, errChunkMissing
+	}
+	return val, nil
+}
+
+// promoteStreamIntoBolt writes the provided number of bytes staged for the
+// stream with the provided ID into the bolt database as the chunked value with
+// the provided key and expiration time. The staged chunks are copied within
+// the database as the chunks of a large value are written, without assembling
+// the value.
+func (l *LRU) promoteStreamIntoBolt(key []byte, id uint64, n int64, exp time.Time) error {
+	return l.writeChunks(key, n, exp, nil, func(tx *bolt.Tx, idx uint64) ([]byte, error) {
+		sb := tx.Bucket(l.pName).Bucket(streamKey(id))
+		if sb == nil {
+			return nil, errChunkMissing
+		}
+		return sb.Get(chunkKey(idx)), nil
+	})
+}
+
+// deleteStreamFromBolt deletes all staged chunks of the stream with the
+// provided ID.
+func (l *LRU) deleteStreamFromBolt(id uint64) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(l.pName).DeleteBucket(streamKey(id))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,281 @@
+package lru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream", func() {
+
+	Context("GetReader", func() {
+
+		It("should stream a value from a StreamStore and cache it", func() {
+			l := NewLRU("", "", DefaultTwoQ(1e7), nil)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			val := bytes.Repeat([]byte("value"), streamChunkSize/2)
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				return ioutil.NopCloser(bytes.NewReader(val)), int64(len(val)), nil
+			}}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.Size()).Should(Equal(int64(len(val))))
+			v, err := ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal(val))
+			err = r.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(func() []byte {
+				return l.getFromBolt([]byte("key"))
+			}).Should(Equal(val))
+			Eventually(func() int {
+				return stagedChunks(l)
+			}).Should(Equal(0))
+
+			// the staged chunks are promoted as the value's chunks
+			l.db.View(func(tx *bolt.Tx) error {
+				cb := tx.Bucket(l.bName).Bucket([]byte("key"))
+				Ω(cb).ShouldNot(BeNil())
+				Ω(cb.Get(chunkKey(0))).Should(HaveLen(streamChunkSize))
+				Ω(chunkedSize(cb)).Should(Equal(int64(len(val))))
+				return nil
+			})
+			r, err = l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err = ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal(val))
+			Ω(r.Close()).Should(Succeed())
+		})
+
+		It("should cache an empty value from a StreamStore", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				return ioutil.NopCloser(bytes.NewReader(nil)), 0, nil
+			}}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(BeEmpty())
+			Ω(r.Close()).Should(Succeed())
+			Eventually(func() bool {
+				return l.Contains([]byte("key"))
+			}).Should(BeTrue())
+			Ω(l.getFromBolt([]byte("key"))).Should(Equal([]byte{}))
+		})
+
+		It("should share a stream between readers and read chunks as they are staged", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			pr, pw := io.Pipe()
+			var calls int64
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				atomic.AddInt64(&calls, 1)
+				return pr, -1, nil
+			}}
+			r1, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r1.Close()
+			r2, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r2.Close()
+			Ω(atomic.LoadInt64(&calls)).Should(Equal(int64(1)))
+			Ω(r1.Size()).Should(Equal(int64(-1)))
+
+			// the first chunk is readable before the stream completes
+			chunk := bytes.Repeat([]byte("a"), streamChunkSize)
+			go pw.Write(chunk)
+			p := make([]byte, streamChunkSize)
+			_, err = io.ReadFull(r1, p)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(p).Should(Equal(chunk))
+
+			go func() {
+				pw.Write([]byte("end"))
+				pw.Close()
+			}()
+			var buf bytes.Buffer
+			n, err := r2.WriteTo(&buf)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(n).Should(Equal(int64(streamChunkSize + 3)))
+			Ω(r1.Size()).Should(Equal(int64(streamChunkSize + 3)))
+			rest, err := ioutil.ReadAll(r1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(rest)).Should(Equal("end"))
+		})
+
+		It("should read at offsets and seek within a stream", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				return ioutil.NopCloser(bytes.NewReader([]byte("value"))), -1, nil
+			}}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r.Close()
+			off, err := r.Seek(-3, io.SeekEnd)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(off).Should(Equal(int64(2)))
+			v, err := ioutil.ReadAll(r)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("lue"))
+			p := make([]byte, 2)
+			n, err := r.ReadAt(p, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(n).Should(Equal(2))
+			Ω(string(p)).Should(Equal("al"))
+			n, err = r.ReadAt(p, 4)
+			Ω(err).Should(Equal(io.EOF))
+			Ω(n).Should(Equal(1))
+			_, err = r.ReadAt(p, -1)
+			Ω(err).Should(Equal(errNegativeOffset))
+		})
+
+		It("should share a stream with a caller of Get", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			pr, pw := io.Pipe()
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				return pr, 5, nil
+			}}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r.Close()
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(10 * time.Millisecond)
+				pw.Write([]byte("value"))
+				pw.Close()
+			}()
+			v, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("value"))
+		})
+
+		It("should return an error from a StreamStore and cache a missing value", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetNegativeCache(10, time.Minute)
+			var calls int64
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				atomic.AddInt64(&calls, 1)
+				return nil, 0, ErrNotFound
+			}}
+			for i := 0; i < 2; i++ {
+				r, err := l.GetReader([]byte("key"))
+				Ω(r).Should(BeNil())
+				Ω(err).Should(MatchError(ErrNotFound))
+			}
+			Ω(atomic.LoadInt64(&calls)).Should(Equal(int64(1)))
+		})
+
+		It("should return an error when the stream ends early", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			pr, pw := io.Pipe()
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				return pr, 5, nil
+			}}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer r.Close()
+			go func() {
+				pw.Write([]byte("val"))
+				pw.Close()
+			}()
+			_, err = ioutil.ReadAll(r)
+			Ω(err).Should(Equal(io.ErrUnexpectedEOF))
+			Ω(l.getFromBolt([]byte("key"))).Should(BeNil())
+		})
+
+		It("should close the stream once all readers are closed", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			pr, pw := io.Pipe()
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				return pr, -1, nil
+			}}
+			r, err := l.GetReader([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = r.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(func() error {
+				_, err := pw.Write([]byte("value"))
+				return err
+			}).Should(Equal(io.ErrClosedPipe))
+			Eventually(func() int {
+				l.muReqs.Lock()
+				defer l.muReqs.Unlock()
+				return len(l.reqs)
+			}).Should(Equal(0))
+			Ω(l.getFromBolt([]byte("key"))).Should(BeNil())
+		})
+
+		It("should recover from a panic in a StreamStore's GetStream", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.store = &testStreamStore{getStream: func(key []byte) (io.ReadCloser, int64, error) {
+				panic("error message")
+			}}
+			_, err := l.GetReader([]byte("key"))
+			Ω(err).Should(MatchError("panic: error message"))
+		})
+	})
+
+	Context("fillCacheFromBolt", func() {
+
+		It("should discard staged streams", func() {
+			l := newDefaultLRU()
+			err := l.putStreamIntoBolt(0, 0, []byte("chunk"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stagedChunks(l)).Should(Equal(1))
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			Ω(stagedChunks(l)).Should(Equal(0))
+		})
+	})
+})
+
+func stagedChunks(l *LRU) int {
+	var n int
+	l.db.View(func(tx *bolt.Tx) error {
+		pb := tx.Bucket(l.pName)
+		return pb.ForEach(func(k, _ []byte) error {
+			n += pb.Bucket(k).Stats().KeyN
+			return nil
+		})
+	})
+	return n
+}
+
+type testStreamStore struct {
+	getStream func([]byte) (io.ReadCloser, int64, error)
+}
+
+func (s *testStreamStore) Open() error {
+	return nil
+}
+func (s *testStreamStore) Close() error {
+	return nil
+}
+func (s *testStreamStore) Get(key []byte) ([]byte, error) {
+	return nil, errors.New("unexpected Get")
+}
+func (s *testStreamStore) GetStream(key []byte) (io.ReadCloser, int64, error) {
+	return s.getStream(key)
+}
@@ -0,0 +1,127 @@
+package lru
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// defaultReapInterval is the default interval at which expired items are
+// purged from the LRU.
+const defaultReapInterval = time.Minute
+
+// SetTTL sets the default time-to-live of all items subsequently inserted into
+// the cache, either with Put or after being retrieved from the remote store. A
+// TTL that is not positive disables expiration, which is the default.
+func (l *LRU) SetTTL(ttl time.Duration) {
+	l.mu.Lock()
+	l.ttl = ttl
+	l.mu.Unlock()
+}
+
+// SetReapInterval sets the interval at which expired items are purged from the
+// cache in the background. An interval that is not positive disables the
+// background purge, in which case expired items are only replaced once they
+// are requested again. This method must be called before Open.
+func (l *LRU) SetReapInterval(interval time.Duration) {
+	l.reapInt = interval
+}
+
+// SetStaleGrace sets the period after an item's expiration during which its
+// stale value is still returned by Get and GetBuffer. While an item is stale,
+// its value is refreshed from the remote store in the background, with at most
+// one refresh in progress per key. A grace period that is not positive, which
+// is the default, causes expired items to be treated as misses.
+func (l *LRU) SetStaleGrace(grace time.Duration) {
+	l.mu.Lock()
+	if grace < 0 {
+		grace = 0
+	}
+	l.grace = grace
+	l.mu.Unlock()
+}
+
+// defaultTTL returns the default time-to-live of new items.
+func (l *LRU) defaultTTL() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ttl
+}
+
+// expiryFromTTL returns the expiration time of an item inserted now with the
+// provided TTL, or the zero time if the item should never expire.
+func expiryFromTTL(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// isExpired returns true if the item with the provided key has an expiration
+// time that isn't after the provided time.
+// Note: this method should only be called when the LRU mutex is locked!
+func (l *LRU) isExpired(key []byte, now time.Time) bool {
+	exp, ok := l.expires[string(key)]
+	return ok && !now.Before(exp)
+}
+
+// setExpiry sets the expiration time of the item with the provided key. A zero
+// expiration time removes any existing expiration.
+// Note: this method should only be called when the LRU mutex is locked!
+func (l *LRU) setExpiry(key []byte, exp time.Time) {
+	if exp.IsZero() {
+		delete(l.expires, string(key))
+		return
+	}
+	l.expires[string(key)] = exp
+}
+
+// reap removes all expired items that are past the stale grace period from the
+// LRU and the bolt database.
+func (l *LRU) reap() {
+	var keys [][]byte
+	l.mu.Lock()
+	now := time.Now().Add(-l.grace)
+	for key := range l.expires {
+		if k := []byte(key); l.isExpired(k, now) {
+			keys = append(keys, k)
+		}
+	}
+	for _, key := range keys {
+		if l.lru.Remove(key) >= 0 {
+			l.expired++
+		}
+		delete(l.expires, string(key))
+	}
+	l.mu.Unlock()
+	if len(keys) > 0 {
+		l.deleteFromBolt(keys, nil)
+	}
+}
+
+// encodeExpiry encodes the provided expiration time for storage in the bolt
+// database.
+func encodeExpiry(exp time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(exp.UnixNano()))
+	return b
+}
+
+// putExpiry writes the provided expiration time of the provided key into the
+// provided expiry bucket. A zero expiration time deletes any existing one.
+func putExpiry(eb *bolt.Bucket, key []byte, exp time.Time) error {
+	if exp.IsZero() {
+		return eb.Delete(key)
+	}
+	return eb.Put(key, encodeExpiry(exp))
+}
+
+// decodeExpiry decodes an expiration time stored in the bolt database. The
+// zero time is returned if the provided bytes are invalid.
+func decodeExpiry(b []byte) time.Time {
+	if len(b) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
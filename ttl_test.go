@@ -0,0 +1,183 @@
+package lru
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TTL", func() {
+
+	Context("SetTTL", func() {
+
+		It("should expire values put into the cache after the default TTL", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetTTL(50 * time.Millisecond)
+			err := l.Put([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("value"))
+			time.Sleep(50 * time.Millisecond)
+			_, err = l.Get([]byte("key"))
+			Ω(err).Should(MatchError(errNoStore))
+			Ω(l.misses).Should(Equal(int64(1)))
+		})
+
+		It("should expire values retrieved from the remote store after the default TTL", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetTTL(time.Hour)
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				return []byte("value"), nil
+			})
+			_, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(func() bool {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				_, ok := l.expires["key"]
+				return ok
+			}, 100*time.Millisecond, time.Millisecond).Should(BeTrue())
+		})
+	})
+
+	Context("PutWithTTL", func() {
+
+		It("should treat an expired value as a miss in GetBuffer", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.PutWithTTL([]byte("key"), []byte("value"), 50*time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			buf, err := l.GetBuffer([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stringFromWriterTo(buf)).Should(Equal("value"))
+			time.Sleep(50 * time.Millisecond)
+			_, err = l.GetBuffer([]byte("key"))
+			Ω(err).Should(MatchError(errNoStore))
+		})
+
+		It("should never expire a value with a TTL that is not positive", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetTTL(time.Millisecond)
+			err := l.PutWithTTL([]byte("key"), []byte("value"), 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			time.Sleep(2 * time.Millisecond)
+			v, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(v)).Should(Equal("value"))
+			Ω(l.expires).Should(HaveLen(0))
+		})
+
+		It("should persist expiration times across restarts", func() {
+			l := newDefaultLRU()
+			err := l.PutWithTTL([]byte("key1"), []byte("value"), time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.PutWithTTL([]byte("key2"), []byte("value"), 10*time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Put([]byte("key3"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			closeBoltDB(l)
+			time.Sleep(15 * time.Millisecond)
+
+			l = newDefaultLRU()
+			defer closeBoltDB(l)
+			Ω(l.lru.Len()).Should(Equal(int64(2)))
+			Ω(l.expires).Should(HaveLen(1))
+			Ω(l.expires).Should(HaveKey("key1"))
+			Ω(l.getFromBolt([]byte("key2"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("key3"))).ShouldNot(BeNil())
+		})
+	})
+
+	Context("SetStaleGrace", func() {
+
+		It("should serve a stale value and refresh it from the remote store once", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetStaleGrace(time.Hour)
+			var reqs int64
+			release := make(chan struct{})
+			l.store = newStore(func(key []byte) ([]byte, error) {
+				atomic.AddInt64(&reqs, 1)
+				<-release
+				return []byte("fresh"), nil
+			})
+			err := l.PutWithTTL([]byte("key"), []byte("stale"), time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			time.Sleep(2 * time.Millisecond)
+			for i := 0; i < 3; i++ {
+				v, err := l.Get([]byte("key"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(v)).Should(Equal("stale"))
+			}
+			Ω(l.Stats().StaleHits).Should(Equal(int64(3)))
+			close(release)
+			Eventually(func() string {
+				v, _ := l.Get([]byte("key"))
+				return string(v)
+			}, 100*time.Millisecond, time.Millisecond).Should(Equal("fresh"))
+			Ω(atomic.LoadInt64(&reqs)).Should(Equal(int64(1)))
+		})
+
+		It("should treat a value past the grace period as a miss", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetStaleGrace(time.Millisecond)
+			err := l.PutWithTTL([]byte("key"), []byte("stale"), time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			time.Sleep(3 * time.Millisecond)
+			_, err = l.Get([]byte("key"))
+			Ω(err).Should(MatchError(errNoStore))
+			Ω(l.Stats().StaleHits).Should(Equal(int64(0)))
+		})
+
+		It("should not reap values within the grace period", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			l.SetStaleGrace(time.Hour)
+			err := l.PutWithTTL([]byte("key"), []byte("stale"), time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			time.Sleep(2 * time.Millisecond)
+			l.reap()
+			Ω(l.lru.Len()).Should(Equal(int64(1)))
+			Ω(l.getFromBolt([]byte("key"))).ShouldNot(BeNil())
+		})
+	})
+
+	Context("reap", func() {
+
+		It("should purge expired values from the LRU and bolt database", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.PutWithTTL([]byte("key1"), []byte("value"), time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.PutWithTTL([]byte("key2"), []byte("value"), time.Hour)
+			Ω(err).ShouldNot(HaveOccurred())
+			time.Sleep(2 * time.Millisecond)
+			l.reap()
+			Ω(l.lru.Len()).Should(Equal(int64(1)))
+			Ω(l.expires).Should(HaveLen(1))
+			Ω(l.getFromBolt([]byte("key1"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("key2"))).ShouldNot(BeNil())
+			Ω(l.Stats().Expired).Should(Equal(int64(1)))
+		})
+
+		It("should purge expired values in the background", func() {
+			l := NewLRU("", "", DefaultTwoQ(0), nil)
+			l.SetReapInterval(time.Millisecond)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.PutWithTTL([]byte("key"), []byte("value"), time.Millisecond)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(func() int64 {
+				return l.Stats().NumItems
+			}, 100*time.Millisecond, time.Millisecond).Should(Equal(int64(0)))
+		})
+	})
+})
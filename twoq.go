@@ -125,6 +125,16 @@ func (tq *TwoQ) Get(key []byte) int64 {
 	return -1
 }
 
+// Peek returns the size of the value corresponding to the provided key, or -1
+// if the key doesn't exist in the hot or warm LRUs, without moving the item
+// within or between the LRUs.
+func (tq *TwoQ) Peek(key []byte) int64 {
+	if i, ok := tq.items[string(key)]; ok && i.status != twoQCold {
+		return i.size
+	}
+	return -1
+}
+
 // PutAndEvict inserts the provided key and value size into the LRU and returns
 // a slice of keys that have been evicted and total bytes evicted.
 func (tq *TwoQ) PutAndEvict(key []byte, size int64) ([][]byte, int64) {
@@ -161,6 +171,28 @@ func (tq *TwoQ) PutAndEvict(key []byte, size int64) ([][]byte, int64) {
 	return tq.prune()
 }
 
+// Remove removes the item with the provided key from all internal LRUs and
+// returns its size, or -1 if the key doesn't exist in the hot or warm LRUs. An
+// item in the cold LRU is removed as well, so that it is no longer promoted
+// directly to the hot LRU when inserted again.
+func (tq *TwoQ) Remove(key []byte) int64 {
+	i, ok := tq.items[string(key)]
+	if !ok {
+		return -1
+	}
+	delete(tq.items, string(key))
+	switch i.status {
+	case twoQHot:
+		tq.lruHot.removeElem(i.elem)
+		return i.size
+	case twoQWarm:
+		tq.lruWarm.removeElem(i.elem)
+		return i.size
+	}
+	tq.lruCold.removeElem(i.elem)
+	return -1
+}
+
 // Cap returns the total capacity of the LRU in bytes.
 func (tq *TwoQ) Cap() int64 {
 	return tq.cap
@@ -205,6 +237,56 @@ func (tq *TwoQ) PutOnStartup(key []byte, size int64) bool {
 	return false
 }
 
+// MarshalState returns the serialized state of the LRU, including the recency
+// order of the items in each of the hot, warm and cold LRUs.
+func (tq *TwoQ) MarshalState() ([]byte, error) {
+	return encodeState(walkRecency(tq)), nil
+}
+
+// UnmarshalState replaces the state of the LRU with the provided state returned
+// by MarshalState. Items are restored into their hot, warm or cold LRUs in
+// their recency order. Once the LRU's capacity is reached, hot and warm items
+// are restored into the cold LRU instead until it is full as well. The LRU is
+// left unchanged if the state is invalid.
+func (tq *TwoQ) UnmarshalState(state []byte) error {
+	return restoreRecency(tq, state)
+}
+
+// walk calls the provided function for every item in the hot, the warm and then
+// the cold LRU, from the most to the least recently used.
+func (tq *TwoQ) walk(fn func([]byte, int64, uint8)) {
+	for _, ll := range []*twoQList{tq.lruHot, tq.lruWarm, tq.lruCold} {
+		for e := ll.list.Front(); e != nil; e = e.Next() {
+			i := e.Value.(*twoQItem)
+			fn(i.key, i.size, ll.status)
+		}
+	}
+}
+
+// restore adds the provided key and value size to the back of the LRU of the
+// provided queue, and returns true if the key was added to the hot or warm
+// LRU. Once the LRU is full, hot and warm items are added to the cold LRU
+// until it is full as well.
+func (tq *TwoQ) restore(key []byte, size int64, queue uint8) bool {
+	i := &twoQItem{key: key, size: size}
+	ll := tq.lruCold
+	switch queue {
+	case twoQHot:
+		ll = tq.lruHot
+	case twoQWarm:
+		ll = tq.lruWarm
+	}
+	if ll != tq.lruCold && tq.Size()+size > tq.cap {
+		ll = tq.lruCold
+	}
+	if ll == tq.lruCold && tq.lruCold.size+size > tq.lruCold.cap {
+		return false
+	}
+	ll.pushToBack(i)
+	tq.items[string(key)] = i
+	return ll != tq.lruCold
+}
+
 // prune prunes any excess items off of the back of the warm LRU, or if under
 // the warm/hot ratio, the hot LRU, and returns a slice of keys that have been
 // evicted and the total bytes evicted.
@@ -266,6 +348,13 @@ func (ll *twoQList) pushToFront(i *twoQItem) {
 	i.status = ll.status
 }
 
+// pushToBack inserts the provided item into the back of the list.
+func (ll *twoQList) pushToBack(i *twoQItem) {
+	i.elem = ll.list.PushBack(i)
+	ll.size += i.size
+	i.status = ll.status
+}
+
 // removeElem removes the provided list element from the linked list and returns
 // the associated item.
 func (ll *twoQList) removeElem(elem *list.Element) *twoQItem {
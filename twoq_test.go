@@ -88,6 +88,31 @@ var _ = Describe("Twoq", func() {
 		})
 	})
 
+	Context("Peek", func() {
+
+		It("should return -1 when the key doesn't exist in the LRU", func() {
+			tq := DefaultTwoQ(0)
+			Ω(tq.Peek([]byte("key"))).Should(Equal(int64(-1)))
+		})
+
+		It("should return an item's size without promoting it to the hot LRU", func() {
+			tq := NewTwoQ(0, 0.0, 0.25, 0.5)
+			tq.PutAndEvict([]byte("key"), 100)
+			Ω(tq.Peek([]byte("key"))).Should(Equal(int64(100)))
+			Ω(tq.items["key"].status).Should(Equal(uint8(twoQWarm)))
+			Ω(tq.lruHot.list.Len()).Should(Equal(0))
+		})
+
+		It("should return -1 for an item in the cold LRU", func() {
+			tq := NewTwoQ(0, 0.0, 0.25, 0.5)
+			for i := 0; i < 4; i++ {
+				tq.PutAndEvict([]byte(strconv.Itoa(i)), 300)
+			}
+			Ω(tq.items["0"].status).Should(Equal(uint8(twoQCold)))
+			Ω(tq.Peek([]byte("0"))).Should(Equal(int64(-1)))
+		})
+	})
+
 	Context("PutAndEvict", func() {
 
 		It("should insert a new item", func() {
@@ -155,6 +180,41 @@ var _ = Describe("Twoq", func() {
 		})
 	})
 
+	Context("Remove", func() {
+
+		It("should return -1 when the key doesn't exist in the LRU", func() {
+			tq := DefaultTwoQ(0)
+			size := tq.Remove([]byte("key"))
+			Ω(size).Should(Equal(int64(-1)))
+		})
+
+		It("should remove items from the hot and warm LRUs", func() {
+			tq := NewTwoQ(0, 0.0, 0.25, 0.5)
+			tq.PutAndEvict([]byte("hot"), 100)
+			tq.Get([]byte("hot"))
+			tq.PutAndEvict([]byte("warm"), 200)
+			Ω(tq.Remove([]byte("hot"))).Should(Equal(int64(100)))
+			Ω(tq.Remove([]byte("warm"))).Should(Equal(int64(200)))
+			Ω(tq.items).Should(HaveLen(0))
+			Ω(tq.Size()).Should(Equal(int64(0)))
+			Ω(tq.Len()).Should(Equal(int64(0)))
+		})
+
+		It("should remove an item from the cold LRU", func() {
+			tq := NewTwoQ(0, 0.0, 0.25, 0.5)
+			for i := 0; i < 4; i++ {
+				tq.PutAndEvict([]byte(strconv.Itoa(i)), 300)
+			}
+			Ω(tq.items["0"].status).Should(Equal(uint8(twoQCold)))
+			Ω(tq.Remove([]byte("0"))).Should(Equal(int64(-1)))
+			Ω(tq.items).ShouldNot(HaveKey("0"))
+			Ω(tq.lruCold.list.Len()).Should(Equal(0))
+			Ω(tq.lruCold.size).Should(Equal(int64(0)))
+			tq.PutAndEvict([]byte("0"), 300)
+			Ω(tq.items["0"].status).Should(Equal(uint8(twoQWarm)))
+		})
+	})
+
 	Context("Empty", func() {
 
 		It("should completely empty the LRU", func() {
@@ -209,6 +269,80 @@ var _ = Describe("Twoq", func() {
 		})
 	})
 
+	Context("restore", func() {
+
+		It("should append items to the back of their lists until past its capacity", func() {
+			tq := DefaultTwoQ(0)
+			Ω(tq.restore([]byte("0"), 300, twoQHot)).Should(BeTrue())
+			Ω(tq.restore([]byte("1"), 300, twoQWarm)).Should(BeTrue())
+			Ω(tq.restore([]byte("2"), 300, twoQHot)).Should(BeTrue())
+			Ω(tq.restore([]byte("3"), 300, twoQHot)).Should(BeFalse())
+			Ω(keysOf(tq.lruHot)).Should(Equal([]string{"0", "2"}))
+			Ω(keysOf(tq.lruWarm)).Should(Equal([]string{"1"}))
+			Ω(keysOf(tq.lruCold)).Should(Equal([]string{"3"}))
+			var keys []string
+			tq.walk(func(key []byte, _ int64, queue uint8) {
+				keys = append(keys, string(key)+":"+strconv.Itoa(int(queue)))
+			})
+			Ω(keys).Should(Equal([]string{"0:0", "2:0", "1:1", "3:2"}))
+		})
+	})
+
+	Context("MarshalState", func() {
+
+		It("should restore items into their lists in recency order", func() {
+			tq := NewTwoQ(0, 0.0, 0.25, 0.5)
+			for i := 0; i < 4; i++ {
+				tq.PutAndEvict([]byte(strconv.Itoa(i)), 300)
+			}
+			tq.Get([]byte("2"))
+			tq.Get([]byte("3"))
+			state, err := tq.MarshalState()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			r := NewTwoQ(0, 0.0, 0.25, 0.5)
+			r.PutAndEvict([]byte("other"), 100)
+			err = r.UnmarshalState(state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(keysOf(r.lruHot)).Should(Equal([]string{"3", "2"}))
+			Ω(keysOf(r.lruWarm)).Should(Equal([]string{"1"}))
+			Ω(keysOf(r.lruCold)).Should(Equal([]string{"0"}))
+			Ω(r.Len()).Should(Equal(int64(3)))
+			Ω(r.Size()).Should(Equal(int64(900)))
+			Ω(r.Peek([]byte("other"))).Should(Equal(int64(-1)))
+
+			// a restored cold item is promoted directly to the hot list
+			r.PutAndEvict([]byte("0"), 300)
+			Ω(keysOf(r.lruHot)).Should(Equal([]string{"0", "3", "2"}))
+		})
+
+		It("should restore items into the cold list past its capacity", func() {
+			tq := NewTwoQ(2000, 0.0, 0.25, 0.5)
+			for i := 0; i < 4; i++ {
+				tq.PutAndEvict([]byte(strconv.Itoa(i)), 300)
+				tq.Get([]byte(strconv.Itoa(i)))
+			}
+			state, err := tq.MarshalState()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			r := NewTwoQ(0, 0.0, 0.25, 0.5)
+			err = r.UnmarshalState(state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(keysOf(r.lruHot)).Should(Equal([]string{"3", "2", "1"}))
+			Ω(keysOf(r.lruCold)).Should(Equal([]string{"0"}))
+		})
+
+		It("should return an error and leave the LRU unchanged for an invalid state", func() {
+			tq := DefaultTwoQ(0)
+			tq.PutAndEvict([]byte("key"), 100)
+			err := tq.UnmarshalState([]byte{0})
+			Ω(err).Should(Equal(ErrInvalidState))
+			err = tq.UnmarshalState([]byte{stateVersion, twoQCold + 1, 1, 'k', 1})
+			Ω(err).Should(Equal(ErrInvalidState))
+			Ω(tq.Peek([]byte("key"))).Should(Equal(int64(100)))
+		})
+	})
+
 	Context("prune", func() {
 
 		It("should prune from the warm lru", func() {
@@ -0,0 +1,106 @@
+package lru
+
+// WriteMode represents the mode in which Set and Unset write into the remote
+// store.
+type WriteMode int
+
+const (
+	// WriteThrough writes into the remote store synchronously, and then
+	// into the cache once the remote store write succeeds.
+	WriteThrough WriteMode = iota
+
+	// WriteBack writes into the cache synchronously, and queues the remote
+	// store write in a journal within the bolt database, in the same
+	// transaction as the cache write. The journal is flushed into the
+	// remote store in the background, retrying failed writes in order, and
+	// any writes left unflushed when the process exits are replayed on the
+	// next Open.
+	WriteBack
+)
+
+// SetWriteMode sets the mode in which Set and Unset write into the remote
+// store. The default mode is WriteThrough. This method must be called before
+// Open.
+func (l *LRU) SetWriteMode(mode WriteMode) {
+	l.wmode = mode
+}
+
+// SetMaxFlushAttempts sets the maximum number of failed attempts to flush a
+// write queued in WriteBack mode, after which the write is dropped from the
+// journal and counted in the LRU's JournalDrops stat. The cache keeps the
+// dropped write's value, which the remote store may then no longer match. A
+// value of 0, which is the default, retries failed writes until they succeed.
+// Writes the store rejects with ErrNotWritable are always dropped, while
+// deletions of keys the store doesn't hold succeed. This method must be called before
+// Open.
+func (l *LRU) SetMaxFlushAttempts(n int) {
+	l.maxFlush = n
+}
+
+// Set writes the provided key and value into both the remote store and the
+// cache, according to the LRU's write mode. ErrNotWritable is returned if the
+// remote store isn't a WritableStore.
+//
+// In WriteBack mode, Set returns once the value is cached and its remote store
+// write is queued. Until the write is flushed, retrieving the value after it
+// has been evicted from the cache returns the queued value rather than the
+// remote store's previous value.
+func (l *LRU) Set(key, val []byte) error {
+	if len(key) == 0 {
+		return ErrNoKey
+	}
+	if val == nil {
+		return ErrNoValue
+	}
+	ws, ok := writableStore(l.store)
+	if !ok {
+		return ErrNotWritable
+	}
+	if l.wmode == WriteBack {
+		if err := l.putWithTTL(key, val, l.defaultTTL(), true); err != nil {
+			return err
+		}
+		l.signalFlush()
+		return nil
+	}
+	if err := ws.Put(key, val); err != nil {
+		return err
+	}
+	return l.Put(key, val)
+}
+
+// Unset deletes the provided key from both the remote store and the cache,
+// according to the LRU's write mode. ErrNotWritable is returned if the remote
+// store isn't a WritableStore.
+//
+// In WriteBack mode, Unset returns once the value is deleted from the cache and
+// its remote store deletion is queued. Until the deletion is flushed,
+// retrieving the value returns ErrNotFound without contacting the remote store.
+func (l *LRU) Unset(key []byte) error {
+	if len(key) == 0 {
+		return ErrNoKey
+	}
+	ws, ok := writableStore(l.store)
+	if !ok {
+		return ErrNotWritable
+	}
+	if l.wmode == WriteBack {
+		j := newJournalEntry(journalDelete, key, nil)
+		if err := l.delete([][]byte{key}, j); err != nil {
+			return err
+		}
+		l.signalFlush()
+		return nil
+	}
+	if err := ws.Delete(key); err != nil {
+		return err
+	}
+	return l.Delete(key)
+}
+
+// Flush writes all remote store writes queued in the journal into the remote
+// store, in order, and returns the first error encountered. Writes that failed
+// remain queued and are retried in the background.
+func (l *LRU) Flush() error {
+	return l.flushJournal()
+}
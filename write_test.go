@@ -0,0 +1,536 @@
+package lru
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Write", func() {
+
+	newWritableLRU := func(mode WriteMode, ws *testWritableStore) *LRU {
+		l := NewLRU("", "", DefaultTwoQ(0), ws)
+		l.SetWriteMode(mode)
+		err := l.Open()
+		Ω(err).ShouldNot(HaveOccurred())
+		return l
+	}
+
+	Context("Set", func() {
+
+		It("should return an error when the store isn't writable", func() {
+			l := newDefaultLRU()
+			defer closeBoltDB(l)
+			err := l.Set([]byte("key"), []byte("value"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			err = l.Unset([]byte("key"))
+			Ω(err).Should(Equal(ErrNotWritable))
+			err = l.Set(nil, []byte("value"))
+			Ω(err).Should(Equal(ErrNoKey))
+			err = l.Set([]byte("key"), nil)
+			Ω(err).Should(Equal(ErrNoValue))
+		})
+
+		It("should write through into the remote store and then the cache", func() {
+			ws := newWritableStore()
+			l := newWritableLRU(WriteThrough, ws)
+			defer closeBoltDB(l)
+			err := l.Set([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("key")).Should(Equal([]byte("value")))
+			Ω(l.getFromBolt([]byte("key"))).Should(Equal([]byte("value")))
+
+			err = l.Unset([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("key")).Should(BeNil())
+			Ω(l.getFromBolt([]byte("key"))).Should(BeNil())
+		})
+
+		It("should not cache a value when writing through fails", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			l := newWritableLRU(WriteThrough, ws)
+			defer closeBoltDB(l)
+			err := l.Set([]byte("key"), []byte("value"))
+			Ω(err).Should(MatchError("test error"))
+			Ω(l.getFromBolt([]byte("key"))).Should(BeNil())
+		})
+
+		It("should write back into the remote store in the background, in order", func() {
+			ws := newWritableStore()
+			l := newWritableLRU(WriteBack, ws)
+			defer closeBoltDB(l)
+			err := l.Set([]byte("a"), []byte("1"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.getFromBolt([]byte("a"))).Should(Equal([]byte("1")))
+			err = l.Set([]byte("b"), []byte("2"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Unset([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.getFromBolt([]byte("b"))).Should(BeNil())
+			Eventually(func() int {
+				return journalLen(l)
+			}).Should(Equal(0))
+			Ω(ws.value("a")).Should(Equal([]byte("1")))
+			Ω(ws.value("b")).Should(BeNil())
+			Ω(ws.ops()).Should(Equal([]string{"put a", "put b", "delete b"}))
+		})
+
+		It("should queue concurrent writes of a key in the order they are cached", func() {
+			ws := newWritableStore()
+			l := newWritableLRU(WriteBack, ws)
+			defer closeBoltDB(l)
+			for i := 0; i < 10; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < 10; j++ {
+					wg.Add(1)
+					go func(v byte) {
+						defer wg.Done()
+						if v%3 == 0 {
+							l.Unset([]byte("key"))
+							return
+						}
+						l.Set([]byte("key"), []byte{v})
+					}(byte(j))
+				}
+				wg.Wait()
+				err := l.Flush()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ws.value("key")).Should(Equal(l.getFromBolt([]byte("key"))))
+			}
+		})
+
+		It("should retry failed writes in the background", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			l := newWritableLRU(WriteBack, ws)
+			defer closeBoltDB(l)
+			err := l.Set([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Flush()
+			Ω(err).Should(MatchError("test error"))
+			Ω(journalLen(l)).Should(Equal(1))
+			ws.setFail(false)
+			Eventually(func() []byte {
+				return ws.value("key")
+			}).Should(Equal([]byte("value")))
+			Eventually(func() int {
+				return journalLen(l)
+			}).Should(Equal(0))
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("journal", func() {
+
+		It("should serve queued writes rather than the remote store's values", func() {
+			ws := newWritableStore()
+			ws.vals["a"] = []byte("old")
+			ws.vals["b"] = []byte("old")
+			ws.setFail(true)
+			l := newWritableLRU(WriteBack, ws)
+			defer closeBoltDB(l)
+			err := l.Unset([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Set([]byte("b"), []byte("new"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Delete([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = l.Get([]byte("a"))
+			Ω(err).Should(Equal(ErrNotFound))
+			v, err := l.Get([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("new")))
+			l.Delete([]byte("b"))
+			vals, errs := l.GetMulti([][]byte{[]byte("a"), []byte("b")})
+			Ω(errs).Should(Equal([]error{ErrNotFound, nil}))
+			Ω(vals[1]).Should(Equal([]byte("new")))
+			Ω(ws.value("a")).Should(Equal([]byte("old")))
+
+			// the remote store's values are retrieved once flushed
+			ws.setFail(false)
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.isPending([]byte("a"))).Should(BeFalse())
+			Ω(l.isPending([]byte("b"))).Should(BeFalse())
+			_, err = l.Get([]byte("a"))
+			Ω(IsNotFound(err)).Should(BeTrue())
+			l.Delete([]byte("b"))
+			v, err = l.Get([]byte("b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("new")))
+		})
+
+		It("should not cache the remote store's value while a deletion is queued", func() {
+			ws := newWritableStore()
+			ws.vals["key"] = []byte("old")
+			l := newWritableLRU(WriteBack, ws)
+			defer closeBoltDB(l)
+
+			// hold the database's write lock so that the deletion's
+			// journal entry can't be committed yet
+			tx, err := l.db.Begin(true)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer tx.Rollback()
+			done := make(chan error, 1)
+			go func() {
+				done <- l.Unset([]byte("key"))
+			}()
+			Eventually(func() bool {
+				l.muReqs.Lock()
+				defer l.muReqs.Unlock()
+				_, ok := l.reqs["key"]
+				return ok
+			}).Should(BeTrue())
+			_, err = l.Get([]byte("key"))
+			Ω(err).Should(Equal(ErrNotFound))
+			tx.Rollback()
+			Ω(<-done).ShouldNot(HaveOccurred())
+			_, err = l.Get([]byte("key"))
+			Ω(IsNotFound(err)).Should(BeTrue())
+			Ω(l.Flush()).Should(Succeed())
+			Ω(ws.value("key")).Should(BeNil())
+		})
+
+		It("should serve ranges of queued writes rather than the remote store's", func() {
+			ws := newWritableStore()
+			ws.vals["key"] = []byte("OLDVALUE")
+			ws.setFail(true)
+			l := NewLRU("", "", DefaultTwoQ(0), &testWritableRangeStore{ws})
+			l.SetWriteMode(WriteBack)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.Set([]byte("key"), []byte("NEWVALUE"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Delete([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := l.GetRange([]byte("key"), 0, 3)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("NEW")))
+			ws.setFail(false)
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should queue a write along with its cache write", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			l := NewLRU("", "", DefaultTwoQ(0), ws)
+			l.SetWriteMode(WriteBack)
+			l.SetChunkSize(2)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.Set([]byte("a"), []byte("1"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Set([]byte("b"), []byte("chunked"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Unset([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(l.getFromBolt([]byte("a"))).Should(BeNil())
+			Ω(l.getFromBolt([]byte("b"))).Should(Equal([]byte("chunked")))
+			Ω(journalLen(l)).Should(Equal(3))
+
+			s := l.Stats()
+			Ω(s.JournalDepth).Should(Equal(int64(3)))
+			Ω(s.JournalAge).Should(BeNumerically(">", 0))
+			ws.setFail(false)
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+			s = l.Stats()
+			Ω(s.JournalDepth).Should(Equal(int64(0)))
+			Ω(s.JournalAge).Should(Equal(time.Duration(0)))
+			Ω(ws.ops()).Should(Equal([]string{"put a", "put b", "delete a"}))
+		})
+
+		It("should queue the values of chunked writes in chunks", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			l := NewLRU("", "", DefaultTwoQ(0), ws)
+			l.SetWriteMode(WriteBack)
+			l.SetChunkSize(2)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			err = l.Set([]byte("key"), []byte("chunked"))
+			Ω(err).ShouldNot(HaveOccurred())
+			l.db.View(func(tx *bolt.Tx) error {
+				_, v := tx.Bucket(l.jName).Cursor().First()
+				e, err := decodeJournal(v)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(e.op).Should(Equal(byte(journalPutChunked)))
+				Ω(e.val).Should(BeEmpty())
+				Ω(tx.Bucket(l.vName).Stats().BucketN).Should(Equal(2))
+				return nil
+			})
+
+			// the queued value is served once evicted from the cache
+			err = l.Delete([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			v, err := l.Get([]byte("key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]byte("chunked")))
+			ws.setFail(false)
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("key")).Should(Equal([]byte("chunked")))
+			l.db.View(func(tx *bolt.Tx) error {
+				Ω(tx.Bucket(l.vName).Stats().BucketN).Should(Equal(1))
+				return nil
+			})
+		})
+
+		It("should replay unflushed writes on Open", func() {
+			l := newDefaultLRU()
+			j := newJournalEntry(journalPut, []byte("key"), []byte("value"))
+			err := l.putIntoBolt([]byte("key"), []byte("value"), time.Time{}, j)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).Should(Equal(ErrNotWritable))
+
+			ws := newWritableStore()
+			ws.setFail(true)
+			l = newWritableLRU(WriteBack, ws)
+			defer closeBoltDB(l)
+			Ω(l.getFromBolt([]byte("key"))).Should(Equal([]byte("value")))
+			Ω(l.isPending([]byte("key"))).Should(BeTrue())
+			ws.setFail(false)
+			Eventually(func() []byte {
+				return ws.value("key")
+			}).Should(Equal([]byte("value")))
+			Eventually(func() int {
+				return journalLen(l)
+			}).Should(Equal(0))
+		})
+	})
+
+	Context("Close", func() {
+
+		It("should drain the journal, or keep it for the next Open on failure", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			l := newWritableLRU(WriteBack, ws)
+			err := l.Set([]byte("key"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).Should(MatchError("test error"))
+
+			ws.setFail(false)
+			l = newWritableLRU(WriteBack, ws)
+			Eventually(func() []byte {
+				return ws.value("key")
+			}).Should(Equal([]byte("value")))
+			err = l.Set([]byte("other"), []byte("value"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("other")).Should(Equal([]byte("value")))
+		})
+
+		It("should drop writes that fail too many times", func() {
+			ws := newWritableStore()
+			ws.setFail(true)
+			l := NewLRU("", "", DefaultTwoQ(0), newStore(nil))
+			l.SetWriteMode(WriteBack)
+			l.SetMaxFlushAttempts(2)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			// flush the journal in the foreground only
+			l.store = ws
+			err = l.Set([]byte("a"), []byte("1"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Set([]byte("b"), []byte("2"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = l.Flush()
+			Ω(err).Should(MatchError("test error"))
+			s := l.Stats()
+			Ω(s.JournalDepth).Should(Equal(int64(2)))
+			Ω(s.JournalFails).Should(Equal(int64(1)))
+			Ω(s.JournalDrops).Should(Equal(int64(0)))
+			err = l.Flush()
+			Ω(err).Should(MatchError("test error"))
+			s = l.Stats()
+			Ω(s.JournalDepth).Should(Equal(int64(1)))
+			Ω(s.JournalFails).Should(Equal(int64(1)))
+			Ω(s.JournalDrops).Should(Equal(int64(1)))
+			Ω(l.isPending([]byte("a"))).Should(BeFalse())
+
+			ws.setFail(false)
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+			s = l.Stats()
+			Ω(s.JournalDepth).Should(Equal(int64(0)))
+			Ω(s.JournalFails).Should(Equal(int64(0)))
+			Ω(s.JournalDrops).Should(Equal(int64(1)))
+			Ω(ws.ops()).Should(Equal([]string{"put b"}))
+		})
+
+		It("should not retry writes that can never succeed", func() {
+			ws := newWritableStore()
+			l := NewLRU("", "", DefaultTwoQ(0), newStore(nil))
+			l.SetWriteMode(WriteBack)
+			err := l.Open()
+			Ω(err).ShouldNot(HaveOccurred())
+			defer closeBoltDB(l)
+			l.store = &testStrictStore{ws}
+			err = l.Unset([]byte("a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Set([]byte("b"), []byte("2"))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = l.Unset([]byte("c"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// the deletion of a key the store doesn't hold succeeds
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ws.value("b")).Should(Equal([]byte("2")))
+			Ω(l.Stats().JournalDrops).Should(Equal(int64(0)))
+
+			// writes the store rejects as not writable are dropped
+			err = l.Set([]byte("c"), []byte("3"))
+			Ω(err).ShouldNot(HaveOccurred())
+			l.store = &testReadOnlyStore{ws}
+			err = l.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+			s := l.Stats()
+			Ω(s.JournalDepth).Should(Equal(int64(0)))
+			Ω(s.JournalDrops).Should(Equal(int64(1)))
+		})
+	})
+
+	Context("decodeJournal", func() {
+
+		It("should decode an encoded journal entry", func() {
+			t := time.Unix(0, 1234567890)
+			put := journalEntry{journalPut, t, []byte("key"), []byte("value")}
+			e, err := decodeJournal(encodeJournal(&put))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(e).Should(Equal(put))
+			del := journalEntry{journalDelete, t, []byte("key"), nil}
+			e, err = decodeJournal(encodeJournal(&del))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(e).Should(Equal(del))
+		})
+
+		It("should return an error for an invalid entry", func() {
+			_, err := decodeJournal([]byte{journalPut, 0, 0, 0, 0, 0, 0, 0, 0, 10, 'k'})
+			Ω(err).Should(Equal(errInvalidJournal))
+			_, err = decodeJournal([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 'k'})
+			Ω(err).Should(Equal(errInvalidJournal))
+			_, err = decodeJournal([]byte{journalPut, 1, 'k'})
+			Ω(err).Should(Equal(errInvalidJournal))
+		})
+	})
+})
+
+func journalLen(l *LRU) int {
+	var n int
+	l.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(l.jName).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+type testWritableStore struct {
+	mu   sync.Mutex
+	vals map[string][]byte
+	log  []string
+	fail bool
+}
+
+func newWritableStore() *testWritableStore {
+	return &testWritableStore{vals: make(map[string][]byte)}
+}
+
+func (s *testWritableStore) Open() error {
+	return nil
+}
+func (s *testWritableStore) Close() error {
+	return nil
+}
+func (s *testWritableStore) Get(key []byte) ([]byte, error) {
+	if v := s.value(string(key)); v != nil {
+		return v, nil
+	}
+	return nil, ErrNotFound
+}
+func (s *testWritableStore) Put(key, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("test error")
+	}
+	s.vals[string(key)] = append([]byte(nil), val...)
+	s.log = append(s.log, "put "+string(key))
+	return nil
+}
+func (s *testWritableStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("test error")
+	}
+	delete(s.vals, string(key))
+	s.log = append(s.log, "delete "+string(key))
+	return nil
+}
+func (s *testWritableStore) value(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.vals[key]
+}
+func (s *testWritableStore) ops() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+func (s *testWritableStore) setFail(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+type testStrictStore struct {
+	*testWritableStore
+}
+
+func (s *testStrictStore) Delete(key []byte) error {
+	if s.value(string(key)) == nil {
+		return ErrNotFound
+	}
+	return s.testWritableStore.Delete(key)
+}
+
+type testReadOnlyStore struct {
+	*testWritableStore
+}
+
+func (s *testReadOnlyStore) Put(key, val []byte) error {
+	return ErrNotWritable
+}
+func (s *testReadOnlyStore) Delete(key []byte) error {
+	return ErrNotWritable
+}
+
+type testWritableRangeStore struct {
+	*testWritableStore
+}
+
+func (s *testWritableRangeStore) GetRange(key []byte, offset, length int64) ([]byte, error) {
+	v, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return sliceRange(v, offset, length)
+}